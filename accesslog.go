@@ -0,0 +1,243 @@
+package mux
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AccessLogFormat 访问日志的格式
+type AccessLogFormat int
+
+const (
+	// LogCommon Common Log Format，末尾附加路由名称、路径模板、变量和耗时
+	LogCommon AccessLogFormat = iota
+	// LogCombined Combined Log Format，末尾附加路由名称、路径模板、变量和耗时
+	LogCombined
+	// LogJSON 每行一个 JSON 对象
+	LogJSON
+)
+
+// AccessLogOptions 配置 AccessLog 中间件
+type AccessLogOptions struct {
+	// Format 写入 Output 时使用的格式
+	Format AccessLogFormat
+	// Output 日志写入的位置，默认为 os.Stderr
+	Output io.Writer
+	// Handler 不为空时将日志作为 slog 记录交给它，忽略 Format 和 Output
+	Handler slog.Handler
+}
+
+// accessLogEntry 一次请求的访问日志
+type accessLogEntry struct {
+	Time         time.Time         `json:"time"`
+	RemoteAddr   string            `json:"remote_addr"`
+	PeerAddr     string            `json:"peer_addr,omitempty"`
+	User         string            `json:"user,omitempty"`
+	Method       string            `json:"method"`
+	URI          string            `json:"uri"`
+	Proto        string            `json:"proto"`
+	Status       int               `json:"status"`
+	Bytes        int64             `json:"bytes"`
+	Duration     time.Duration     `json:"-"`
+	DurationMS   float64           `json:"duration_ms"`
+	RouteName    string            `json:"route,omitempty"`
+	PathTemplate string            `json:"template,omitempty"`
+	Vars         map[string]string `json:"vars,omitempty"`
+	Referer      string            `json:"referer,omitempty"`
+	UserAgent    string            `json:"user_agent,omitempty"`
+	RequestID    string            `json:"request_id,omitempty"`
+}
+
+// AccessLog 返回记录访问日志的中间件，日志中包含匹配路由的名称、路径模板和变量
+// 路径模板的取值有限，适合用于聚合，通过 UsePreMatch 注册时也会记录 404 和 405
+func AccessLog(opts AccessLogOptions) MiddlewareFunc {
+	out := opts.Output
+	if out == nil {
+		out = os.Stderr
+	}
+	var mu sync.Mutex
+	write := func(ctx context.Context, e *accessLogEntry) {
+		if opts.Handler != nil {
+			if opts.Handler.Enabled(ctx, slog.LevelInfo) {
+				opts.Handler.Handle(ctx, e.record())
+			}
+			return
+		}
+		var line []byte
+		switch opts.Format {
+		case LogJSON:
+			line, _ = json.Marshal(e)
+			line = append(line, '\n')
+		case LogCombined:
+			line = e.appendCommon(nil, true)
+		default:
+			line = e.appendCommon(nil, false)
+		}
+		mu.Lock()
+		out.Write(line)
+		mu.Unlock()
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			start := time.Now()
+			req, rec := withMatchRecord(req)
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, req)
+
+			e := newAccessLogEntry(req, start, rec)
+			e.Status, e.Bytes = sw.Status(), sw.written
+			if route, vars := rec.matched(req); route != nil {
+				e.RouteName = route.GetName()
+				e.PathTemplate, _ = route.GetPathTemplate()
+				e.Vars = vars
+			}
+			write(req.Context(), e)
+		})
+	}
+}
+
+// newAccessLogEntry 创建访问日志，RemoteAddr 是 ClientIP 返回的客户端地址，
+// 经过受信任的代理时 PeerAddr 记录直接连接的代理地址
+func newAccessLogEntry(req *http.Request, start time.Time, rec *matchRecord) *accessLogEntry {
+	e := &accessLogEntry{
+		Time:      start,
+		PeerAddr:  req.RemoteAddr,
+		Method:    req.Method,
+		URI:       req.RequestURI,
+		Proto:     req.Proto,
+		Duration:  time.Since(start),
+		Referer:   req.Referer(),
+		UserAgent: req.UserAgent(),
+		RequestID: RequestIDFromContext(req.Context()),
+	}
+	e.DurationMS = float64(e.Duration.Microseconds()) / 1000
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		e.PeerAddr = host
+	}
+	e.RemoteAddr = e.PeerAddr
+	if ip := rec.clientIP(req); ip != nil {
+		e.RemoteAddr = ip.String()
+	}
+	if e.RemoteAddr == e.PeerAddr {
+		e.PeerAddr = ""
+	}
+	if e.URI == "" {
+		e.URI = req.URL.RequestURI()
+	}
+	if req.URL.User != nil {
+		e.User = req.URL.User.Username()
+	} else if user, _, ok := req.BasicAuth(); ok {
+		e.User = user
+	}
+	return e
+}
+
+// appendCommon 以 Common 或 Combined 格式追加一行日志
+func (e *accessLogEntry) appendCommon(b []byte, combined bool) []byte {
+	b = append(b, orDash(e.RemoteAddr)...)
+	b = append(b, " - "...)
+	b = append(b, orDash(e.User)...)
+	b = append(b, " ["...)
+	b = e.Time.AppendFormat(b, "02/Jan/2006:15:04:05 -0700")
+	b = append(b, "] "...)
+	b = strconv.AppendQuote(b, e.Method+" "+e.URI+" "+e.Proto)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, int64(e.Status), 10)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, e.Bytes, 10)
+	if combined {
+		b = append(b, ' ')
+		b = strconv.AppendQuote(b, orDash(e.Referer))
+		b = append(b, ' ')
+		b = strconv.AppendQuote(b, orDash(e.UserAgent))
+	}
+	b = append(b, ' ')
+	b = strconv.AppendQuote(b, orDash(e.RouteName))
+	b = append(b, ' ')
+	b = strconv.AppendQuote(b, orDash(e.PathTemplate))
+	b = append(b, ' ')
+	b = strconv.AppendQuote(b, orDash(encodeVars(e.Vars)))
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, e.Duration.Microseconds(), 10)
+	return append(b, '\n')
+}
+
+// record 将日志转换为 slog 记录
+func (e *accessLogEntry) record() slog.Record {
+	r := slog.NewRecord(e.Time, slog.LevelInfo, "http request", 0)
+	r.AddAttrs(
+		slog.String("remote_addr", e.RemoteAddr),
+		slog.String("method", e.Method),
+		slog.String("uri", e.URI),
+		slog.String("proto", e.Proto),
+		slog.Int("status", e.Status),
+		slog.Int64("bytes", e.Bytes),
+		slog.Duration("duration", e.Duration),
+		slog.String("route", e.RouteName),
+		slog.String("template", e.PathTemplate),
+	)
+	if len(e.Vars) > 0 {
+		attrs := make([]any, 0, len(e.Vars))
+		for _, k := range sortedKeys(e.Vars) {
+			attrs = append(attrs, slog.String(k, e.Vars[k]))
+		}
+		r.AddAttrs(slog.Group("vars", attrs...))
+	}
+	if e.PeerAddr != "" {
+		r.AddAttrs(slog.String("peer_addr", e.PeerAddr))
+	}
+	if e.User != "" {
+		r.AddAttrs(slog.String("user", e.User))
+	}
+	if e.Referer != "" {
+		r.AddAttrs(slog.String("referer", e.Referer))
+	}
+	if e.UserAgent != "" {
+		r.AddAttrs(slog.String("user_agent", e.UserAgent))
+	}
+	if e.RequestID != "" {
+		r.AddAttrs(slog.String("request_id", e.RequestID))
+	}
+	return r
+}
+
+// encodeVars 将变量编码为按键排序的查询字符串
+func encodeVars(vars map[string]string) string {
+	var b bytes.Buffer
+	for _, k := range sortedKeys(vars) {
+		if b.Len() > 0 {
+			b.WriteByte('&')
+		}
+		b.WriteString(url.QueryEscape(k))
+		b.WriteByte('=')
+		b.WriteString(url.QueryEscape(vars[k]))
+	}
+	return b.String()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
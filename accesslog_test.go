@@ -0,0 +1,124 @@
+package mux
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	router := NewRouter()
+	router.HandleFunc("/orders/{id}", stringHandler("order")).Name("order")
+	router.UsePreMatch(AccessLog(AccessLogOptions{Output: &buf}))
+
+	req := newRequest("GET", "/orders/42")
+	req.RemoteAddr = "10.0.0.1:1234"
+	router.ServeHTTP(NewRecorder(), req)
+	router.ServeHTTP(NewRecorder(), newRequest("GET", "/missing"))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %q", buf.String())
+	}
+	if !strings.HasPrefix(lines[0], "10.0.0.1 - - [") {
+		t.Errorf("Unexpected line prefix: %q", lines[0])
+	}
+	if !strings.Contains(lines[0], `"GET /orders/42 HTTP/1.1" 200 5 "order" "/orders/{id}" "id=42" `) {
+		t.Errorf("Unexpected line: %q", lines[0])
+	}
+	if !strings.Contains(lines[1], `404 19 "-" "-" "-" `) {
+		t.Errorf("Unexpected line: %q", lines[1])
+	}
+}
+
+func TestAccessLogCombined(t *testing.T) {
+	var buf bytes.Buffer
+	router := NewRouter()
+	router.HandleFunc("/", stringHandler("home"))
+	router.Use(AccessLog(AccessLogOptions{Format: LogCombined, Output: &buf}))
+
+	req := newRequestWithHeaders("GET", "/", "Referer", "http://example.com/", "User-Agent", "test")
+	router.ServeHTTP(NewRecorder(), req)
+
+	if !strings.Contains(buf.String(), `200 4 "http://example.com/" "test" "-" "/" "-" `) {
+		t.Errorf("Unexpected line: %q", buf.String())
+	}
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	var buf bytes.Buffer
+	router := NewRouter()
+	router.HandleFunc("/orders/{id}", stringHandler("order")).Name("order")
+	router.Use(AccessLog(AccessLogOptions{Format: LogJSON, Output: &buf}))
+
+	router.ServeHTTP(NewRecorder(), newRequest("GET", "/orders/42"))
+
+	var e map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e["route"] != "order" || e["template"] != "/orders/{id}" || e["status"] != float64(200) {
+		t.Errorf("Unexpected entry: %v", e)
+	}
+	if vars, _ := e["vars"].(map[string]any); vars["id"] != "42" {
+		t.Errorf("Unexpected vars: %v", e["vars"])
+	}
+}
+
+func TestAccessLogSlog(t *testing.T) {
+	var buf bytes.Buffer
+	router := NewRouter()
+	router.HandleFunc("/orders/{id}", stringHandler("order"))
+	router.Use(AccessLog(AccessLogOptions{Handler: slog.NewTextHandler(&buf, nil)}))
+
+	router.ServeHTTP(NewRecorder(), newRequest("GET", "/orders/42"))
+
+	for _, want := range []string{`msg="http request"`, "status=200", "template=/orders/{id}", "vars.id=42"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected %q in %q", want, buf.String())
+		}
+	}
+}
+
+func TestAccessLogTrustedProxy(t *testing.T) {
+	for _, preMatch := range []bool{false, true} {
+		var buf bytes.Buffer
+		router := NewRouter()
+		if err := router.TrustedProxies("10.0.0.0/8"); err != nil {
+			t.Fatal(err)
+		}
+		router.HandleFunc("/", stringHandler("home"))
+		mw := AccessLog(AccessLogOptions{Format: LogJSON, Output: &buf})
+		if preMatch {
+			router.UsePreMatch(mw)
+		} else {
+			router.Use(mw)
+		}
+
+		tests := []struct {
+			remoteAddr string
+			expRemote  string
+			expPeer    any
+		}{
+			{"10.0.0.1:1234", "203.0.113.7", "10.0.0.1"},
+			{"198.51.100.1:1234", "198.51.100.1", nil},
+		}
+		for _, test := range tests {
+			buf.Reset()
+			req := newRequestWithHeaders("GET", "/", "X-Forwarded-For", "203.0.113.7")
+			req.RemoteAddr = test.remoteAddr
+			router.ServeHTTP(NewRecorder(), req)
+
+			var e map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &e); err != nil {
+				t.Fatal(err)
+			}
+			if e["remote_addr"] != test.expRemote || e["peer_addr"] != test.expPeer {
+				t.Errorf("pre-match %v, %s: unexpected addresses %v %v", preMatch, test.remoteAddr, e["remote_addr"], e["peer_addr"])
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"net/http"
+)
+
+// defaultAPIKeyHeader 默认携带 API 密钥的请求头
+const defaultAPIKeyHeader = "X-API-Key"
+
+// APIKeyStore 根据 API 密钥查找主体
+type APIKeyStore interface {
+	Lookup(key string) (*Principal, bool)
+}
+
+// APIKeyStoreFunc 函数形式的 APIKeyStore
+type APIKeyStoreFunc func(key string) (*Principal, bool)
+
+// Lookup 实现 APIKeyStore
+func (f APIKeyStoreFunc) Lookup(key string) (*Principal, bool) {
+	return f(key)
+}
+
+// StaticAPIKeys 返回保存在内存中的 APIKeyStore，keys 为密钥到主体的映射
+// 密钥以 SHA-256 摘要作为索引，查找时间与密钥内容无关
+func StaticAPIKeys(keys map[string]*Principal) APIKeyStore {
+	s := staticAPIKeys(make(map[[32]byte]*Principal, len(keys)))
+	for key, p := range keys {
+		s[sha256.Sum256([]byte(key))] = p
+	}
+	return s
+}
+
+type staticAPIKeys map[[32]byte]*Principal
+
+func (s staticAPIKeys) Lookup(key string) (*Principal, bool) {
+	p, ok := s[sha256.Sum256([]byte(key))]
+	return p, ok
+}
+
+// APIKeyOptions 配置 API 密钥认证器
+type APIKeyOptions struct {
+	// Header 携带密钥的请求头，默认为 "X-API-Key"
+	Header string
+	// Query 携带密钥的查询参数，为空时不从查询字符串读取
+	Query string
+	// Keys 密钥存储
+	Keys APIKeyStore
+}
+
+// APIKey 返回 API 密钥认证器，优先读取请求头
+func APIKey(opts APIKeyOptions) Authenticator {
+	if opts.Header == "" {
+		opts.Header = defaultAPIKeyHeader
+	}
+	return &apiKeyAuth{opts: opts}
+}
+
+type apiKeyAuth struct {
+	opts APIKeyOptions
+}
+
+func (a *apiKeyAuth) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(a.opts.Header)
+	if key == "" && a.opts.Query != "" {
+		key = r.URL.Query().Get(a.opts.Query)
+	}
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	p, ok := a.opts.Keys.Lookup(key)
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	if p.Scheme == "" {
+		cp := *p
+		cp.Scheme = "apikey"
+		p = &cp
+	}
+	return p, nil
+}
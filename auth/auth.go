@@ -0,0 +1,173 @@
+// Package auth 提供可以通过 Router.Use 注册的认证中间件，
+// 支持 Basic、Bearer JWT 和 API 密钥，认证后的主体保存在请求上下文中
+//
+//	r := mux.NewRouter()
+//	r.HandleFunc("/orders", OrdersHandler).
+//	  Metadata(auth.MetadataScopes, []string{"orders:read"})
+//	r.Use(auth.Middleware(auth.Options{
+//	  Authenticators: []auth.Authenticator{auth.JWT(auth.JWTOptions{Keys: jwks})},
+//	}))
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-mux/mux"
+)
+
+// MetadataScopes 路由元数据中所需权限范围的键，值为 []string，主体必须拥有全部权限范围
+// 也可以使用 Route.Require 声明
+const MetadataScopes = "auth.scopes"
+
+var (
+	// ErrNoCredentials 请求中没有对应的凭据时返回，中间件会尝试下一个认证器
+	ErrNoCredentials = errors.New("auth: no credentials")
+	// ErrInvalidCredentials 凭据无效时返回
+	ErrInvalidCredentials = errors.New("auth: invalid credentials")
+)
+
+// Principal 认证后的主体
+type Principal struct {
+	// ID 主体的标识，如用户名或 JWT 的 sub
+	ID string
+	// Scheme 认证方式，如 "basic"、"bearer" 和 "apikey"
+	Scheme string
+	// Scopes 权限范围
+	Scopes []string
+	// Roles 角色
+	Roles []string
+	// Claims JWT 中的全部声明
+	Claims map[string]any
+}
+
+// Subject 返回主体的标识，实现 mux.Principal
+func (p *Principal) Subject() string {
+	return p.ID
+}
+
+// HasScope 如果主体拥有给定的权限范围，则返回true
+func (p *Principal) HasScope(scope string) bool {
+	return contains(p.Scopes, scope)
+}
+
+// HasRole 如果主体拥有给定的角色，则返回true
+func (p *Principal) HasRole(role string) bool {
+	return contains(p.Roles, role)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// WithPrincipal 返回保存了主体的上下文，主体同时可以通过 mux.PrincipalFromContext 读取
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return mux.WithPrincipal(ctx, p)
+}
+
+// FromContext 返回上下文中的主体
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := mux.PrincipalFromContext(ctx).(*Principal)
+	return p, ok
+}
+
+// Authenticator 从请求中认证主体，请求中没有对应的凭据时返回 ErrNoCredentials
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Challenger 由认证器实现，返回401响应中 WWW-Authenticate 的值
+type Challenger interface {
+	Challenge() string
+}
+
+// Options 配置认证中间件
+type Options struct {
+	// Authenticators 按顺序尝试的认证器
+	Authenticators []Authenticator
+	// Optional 如果为 true，没有凭据且路由不要求权限范围的请求可以匿名访问
+	Optional bool
+	// ErrorHandler 写出401和403响应，默认写出状态码对应的文本
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, code int, err error)
+}
+
+// ErrInsufficientScope 主体缺少路由所需的权限范围时传给 ErrorHandler
+var ErrInsufficientScope = errors.New("auth: insufficient scope")
+
+// Middleware 返回认证中间件，应该通过 Router.Use 注册以读取路由元数据中的权限范围
+// 凭据无效或缺少凭据时返回401，缺少权限范围时返回403
+// 通过 Route.Public 声明的路由按 Optional 处理，没有凭据的请求可以匿名访问
+func Middleware(opts Options) mux.MiddlewareFunc {
+	fail := func(w http.ResponseWriter, r *http.Request, code int, err error) {
+		if code == http.StatusUnauthorized {
+			for _, a := range opts.Authenticators {
+				if c, ok := a.(Challenger); ok {
+					w.Header().Add("WWW-Authenticate", c.Challenge())
+				}
+			}
+		}
+		if opts.ErrorHandler != nil {
+			opts.ErrorHandler(w, r, code, err)
+			return
+		}
+		http.Error(w, http.StatusText(code), code)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := mux.CurrentRoute(r)
+			scopes := RequiredScopes(route)
+			optional := opts.Optional || (route != nil && route.IsPublic())
+
+			var principal *Principal
+			for _, a := range opts.Authenticators {
+				p, err := a.Authenticate(r)
+				if errors.Is(err, ErrNoCredentials) {
+					continue
+				}
+				if err != nil {
+					fail(w, r, http.StatusUnauthorized, err)
+					return
+				}
+				principal = p
+				break
+			}
+
+			if principal == nil {
+				if optional && len(scopes) == 0 {
+					next.ServeHTTP(w, r)
+					return
+				}
+				fail(w, r, http.StatusUnauthorized, ErrNoCredentials)
+				return
+			}
+			for _, scope := range scopes {
+				if !principal.HasScope(scope) {
+					w.Header().Set("WWW-Authenticate",
+						`Bearer error="insufficient_scope", scope="`+strings.Join(scopes, " ")+`"`)
+					fail(w, r, http.StatusForbidden, ErrInsufficientScope)
+					return
+				}
+			}
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+// RequiredScopes 返回路由元数据中和通过 Route.Require 声明的权限范围
+func RequiredScopes(route *mux.Route) []string {
+	if route == nil {
+		return nil
+	}
+	scopes, _ := route.GetMetadataValueOr(MetadataScopes, nil).([]string)
+	if required := route.GetRequiredScopes(); len(required) > 0 {
+		scopes = append(scopes[:len(scopes):len(scopes)], required...)
+	}
+	return scopes
+}
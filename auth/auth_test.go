@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-mux/mux"
+)
+
+func TestBasic(t *testing.T) {
+	a := Basic("admin", StaticUsers(map[string]string{"alice": "secret"}))
+
+	tests := []struct {
+		user, password string
+		setAuth        bool
+		expErr         error
+	}{
+		{"alice", "secret", true, nil},
+		{"alice", "wrong", true, ErrInvalidCredentials},
+		{"bob", "secret", true, ErrInvalidCredentials},
+		{"", "", false, ErrNoCredentials},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		if test.setAuth {
+			req.SetBasicAuth(test.user, test.password)
+		}
+		p, err := a.Authenticate(req)
+		if err != test.expErr {
+			t.Errorf("%s/%s: expected %v, got %v", test.user, test.password, test.expErr, err)
+		}
+		if err == nil && (p.ID != "alice" || p.Scheme != "basic") {
+			t.Errorf("Unexpected principal %+v", p)
+		}
+	}
+	if c := a.(Challenger).Challenge(); c != `Basic realm="admin", charset="UTF-8"` {
+		t.Errorf("Unexpected challenge %q", c)
+	}
+}
+
+func TestAPIKey(t *testing.T) {
+	keys := StaticAPIKeys(map[string]*Principal{"k1": {ID: "svc", Scopes: []string{"orders:read"}}})
+	a := APIKey(APIKeyOptions{Query: "api_key", Keys: keys})
+
+	tests := []struct {
+		target string
+		header string
+		expErr error
+	}{
+		{"/", "k1", nil},
+		{"/?api_key=k1", "", nil},
+		{"/?api_key=k1", "k2", ErrInvalidCredentials},
+		{"/", "", ErrNoCredentials},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.target, nil)
+		if test.header != "" {
+			req.Header.Set("X-API-Key", test.header)
+		}
+		p, err := a.Authenticate(req)
+		if err != test.expErr {
+			t.Errorf("%s %q: expected %v, got %v", test.target, test.header, test.expErr, err)
+		}
+		if err == nil && (p.ID != "svc" || p.Scheme != "apikey") {
+			t.Errorf("Unexpected principal %+v", p)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var principal *Principal
+	var rateKey string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = FromContext(r.Context())
+		rateKey = mux.KeyBySubject(r)
+	}
+	router := mux.NewRouter()
+	router.HandleFunc("/public", handler)
+	router.HandleFunc("/orders", handler).Metadata(MetadataScopes, []string{"orders:read"})
+	router.HandleFunc("/admin", handler).Metadata(MetadataScopes, []string{"admin"})
+	router.Use(Middleware(Options{
+		Authenticators: []Authenticator{
+			Basic("api", StaticUsers(map[string]string{"alice": "secret"})),
+			APIKey(APIKeyOptions{Keys: StaticAPIKeys(map[string]*Principal{
+				"k1": {ID: "svc", Scopes: []string{"orders:read"}},
+			})}),
+		},
+		Optional: true,
+	}))
+
+	tests := []struct {
+		path    string
+		apiKey  string
+		basic   bool
+		expCode int
+		expID   string
+	}{
+		{"/public", "", false, http.StatusOK, ""},
+		{"/orders", "", false, http.StatusUnauthorized, ""},
+		{"/orders", "k1", false, http.StatusOK, "svc"},
+		{"/orders", "bad", false, http.StatusUnauthorized, ""},
+		{"/admin", "k1", false, http.StatusForbidden, ""},
+		{"/public", "", true, http.StatusOK, "alice"},
+	}
+	for _, test := range tests {
+		principal = nil
+		req := httptest.NewRequest("GET", test.path, nil)
+		if test.apiKey != "" {
+			req.Header.Set("X-API-Key", test.apiKey)
+		}
+		if test.basic {
+			req.SetBasicAuth("alice", "secret")
+		}
+		rw := httptest.NewRecorder()
+		router.ServeHTTP(rw, req)
+		if rw.Code != test.expCode {
+			t.Errorf("%s %q: expected %d, got %d", test.path, test.apiKey, test.expCode, rw.Code)
+		}
+		id := ""
+		if principal != nil {
+			id = principal.ID
+		}
+		if id != test.expID {
+			t.Errorf("%s %q: expected principal %q, got %q", test.path, test.apiKey, test.expID, id)
+		}
+		if id != "" && rateKey != "subject:"+id {
+			t.Errorf("%s %q: expected rate limit key for %q, got %q", test.path, test.apiKey, id, rateKey)
+		}
+		if rw.Code == http.StatusUnauthorized && rw.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s %q: expected WWW-Authenticate challenge", test.path, test.apiKey)
+		}
+	}
+}
+
+func TestMiddlewareAuthorize(t *testing.T) {
+	keys := StaticAPIKeys(map[string]*Principal{
+		"k1": {ID: "alice", Scopes: []string{"orders:read"}},
+	})
+	router := mux.NewRouter()
+	router.HandleFunc("/users/{userID}/orders", func(w http.ResponseWriter, r *http.Request) {
+		if p := mux.PrincipalFromContext(r.Context()); p == nil || p.Subject() != "alice" {
+			t.Errorf("Expected principal in mux context, got %v", p)
+		}
+	}).Require("orders:read").Allow("self", mux.SubjectVar("userID"))
+	router.HandleFunc("/orders", func(w http.ResponseWriter, r *http.Request) {}).Require("orders:write")
+	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {}).Public()
+	router.HandleFunc("/reports", func(w http.ResponseWriter, r *http.Request) {}).Public().Require("orders:read")
+	router.Use(
+		Middleware(Options{Authenticators: []Authenticator{APIKey(APIKeyOptions{Keys: keys})}}),
+		mux.Authorize(mux.AuthorizeOptions{}),
+	)
+
+	tests := []struct {
+		path    string
+		apiKey  string
+		expCode int
+	}{
+		{"/users/alice/orders", "k1", http.StatusOK},
+		{"/users/bob/orders", "k1", http.StatusForbidden},
+		{"/orders", "k1", http.StatusForbidden},
+		{"/health", "", http.StatusOK},
+		{"/reports", "", http.StatusUnauthorized},
+		{"/reports", "k1", http.StatusOK},
+		{"/orders", "", http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.path, nil)
+		if test.apiKey != "" {
+			req.Header.Set("X-API-Key", test.apiKey)
+		}
+		rw := httptest.NewRecorder()
+		router.ServeHTTP(rw, req)
+		if rw.Code != test.expCode {
+			t.Errorf("%s %q: expected %d, got %d", test.path, test.apiKey, test.expCode, rw.Code)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+)
+
+// UserStore 校验用户名和密码，实现应该使用常数时间的比较
+type UserStore interface {
+	Verify(username, password string) (*Principal, bool)
+}
+
+// UserStoreFunc 函数形式的 UserStore
+type UserStoreFunc func(username, password string) (*Principal, bool)
+
+// Verify 实现 UserStore
+func (f UserStoreFunc) Verify(username, password string) (*Principal, bool) {
+	return f(username, password)
+}
+
+// StaticUsers 返回保存在内存中的 UserStore，users 为用户名到密码的映射
+// 密码以 SHA-256 摘要保存并使用常数时间比较，用户不存在时也会进行一次比较
+func StaticUsers(users map[string]string) UserStore {
+	s := staticUsers{digests: make(map[string][32]byte, len(users))}
+	for name, password := range users {
+		s.digests[name] = sha256.Sum256([]byte(password))
+	}
+	return s
+}
+
+type staticUsers struct {
+	digests map[string][32]byte
+}
+
+func (s staticUsers) Verify(username, password string) (*Principal, bool) {
+	want, ok := s.digests[username]
+	got := sha256.Sum256([]byte(password))
+	if subtle.ConstantTimeCompare(want[:], got[:]) != 1 || !ok {
+		return nil, false
+	}
+	return &Principal{ID: username, Scheme: "basic"}, true
+}
+
+// Basic 返回 HTTP Basic 认证器
+func Basic(realm string, users UserStore) Authenticator {
+	return &basicAuth{realm: realm, users: users}
+}
+
+type basicAuth struct {
+	realm string
+	users UserStore
+}
+
+func (a *basicAuth) Authenticate(r *http.Request) (*Principal, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	p, ok := a.users.Verify(username, password)
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	return p, nil
+}
+
+func (a *basicAuth) Challenge() string {
+	return "Basic realm=" + strconv.Quote(a.realm) + `, charset="UTF-8"`
+}
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+)
+
+// JWKS JSON Web Key Set，实现 KeySet
+type JWKS struct {
+	keys []jwk
+}
+
+type jwk struct {
+	kid string
+	alg string
+	key any
+}
+
+// ParseJWKS 解析 JWKS 文档，支持 RSA、EC 和 oct 类型的密钥，忽略 use 不是 "sig" 的密钥
+func ParseJWKS(data []byte) (*JWKS, error) {
+	var doc struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Alg string `json:"alg"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+			K   string `json:"k"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("auth: invalid JWKS: %v", err)
+	}
+	set := &JWKS{}
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		var key any
+		var err error
+		switch k.Kty {
+		case "RSA":
+			key, err = parseRSAKey(k.N, k.E)
+		case "EC":
+			key, err = parseECKey(k.Crv, k.X, k.Y)
+		case "oct":
+			key, err = base64.RawURLEncoding.DecodeString(k.K)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("auth: invalid JWK %q: %v", k.Kid, err)
+		}
+		set.keys = append(set.keys, jwk{kid: k.Kid, alg: k.Alg, key: key})
+	}
+	return set, nil
+}
+
+// LoadJWKSFile 从文件中加载 JWKS
+func LoadJWKSFile(path string) (*JWKS, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+// LoadJWKSHandler 通过 GET 请求从 http.Handler 加载 JWKS，
+// 可以用本地的 Handler 代替远程的 JWKS 地址
+func LoadJWKSHandler(h http.Handler, target string) (*JWKS, error) {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	rw := &bufferWriter{header: make(http.Header), code: http.StatusOK}
+	h.ServeHTTP(rw, req)
+	if rw.code != http.StatusOK {
+		return nil, fmt.Errorf("auth: loading JWKS from %s: status %d", target, rw.code)
+	}
+	return ParseJWKS(rw.body.Bytes())
+}
+
+// Key 实现 KeySet，kid 为空时使用唯一的密钥或第一个算法匹配的密钥
+func (s *JWKS) Key(kid, alg string) (any, error) {
+	for _, k := range s.keys {
+		if kid != "" && k.kid != kid {
+			continue
+		}
+		if k.alg != "" && k.alg != alg {
+			continue
+		}
+		return k.key, nil
+	}
+	return nil, fmt.Errorf("no key for kid %q and alg %s", kid, alg)
+}
+
+func parseRSAKey(n, e string) (*rsa.PublicKey, error) {
+	nb, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, err
+	}
+	eb, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, err
+	}
+	exp := new(big.Int).SetBytes(eb)
+	if len(nb) == 0 || !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid RSA key")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(nb), E: int(exp.Int64())}, nil
+}
+
+func parseECKey(crv, x, y string) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	var ecdhCurve ecdh.Curve
+	switch crv {
+	case "P-256":
+		curve, ecdhCurve = elliptic.P256(), ecdh.P256()
+	case "P-384":
+		curve, ecdhCurve = elliptic.P384(), ecdh.P384()
+	case "P-521":
+		curve, ecdhCurve = elliptic.P521(), ecdh.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", crv)
+	}
+	xb, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil {
+		return nil, err
+	}
+	yb, err := base64.RawURLEncoding.DecodeString(y)
+	if err != nil {
+		return nil, err
+	}
+	size := (curve.Params().BitSize + 7) / 8
+	if len(xb) != size || len(yb) != size {
+		return nil, errors.New("invalid EC key")
+	}
+	// 通过未压缩点编码校验点在曲线上
+	point := append([]byte{4}, append(xb, yb...)...)
+	if _, err := ecdhCurve.NewPublicKey(point); err != nil {
+		return nil, errors.New("invalid EC point")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(xb), Y: new(big.Int).SetBytes(yb)}, nil
+}
+
+// bufferWriter 保存 Handler 的响应
+type bufferWriter struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (w *bufferWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (w *bufferWriter) WriteHeader(code int) {
+	w.code = code
+}
@@ -0,0 +1,326 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken JWT 无效时返回，具体原因包装在错误中
+var ErrInvalidToken = errors.New("auth: invalid token")
+
+// KeySet 根据 JWT 头中的 kid 和 alg 返回校验签名的密钥
+// HS 算法使用 []byte，RS 和 PS 算法使用 *rsa.PublicKey，ES 算法使用 *ecdsa.PublicKey
+type KeySet interface {
+	Key(kid, alg string) (any, error)
+}
+
+// KeySetFunc 函数形式的 KeySet
+type KeySetFunc func(kid, alg string) (any, error)
+
+// Key 实现 KeySet
+func (f KeySetFunc) Key(kid, alg string) (any, error) {
+	return f(kid, alg)
+}
+
+// StaticKey 返回对所有 kid 使用同一个密钥的 KeySet
+func StaticKey(key any) KeySet {
+	return KeySetFunc(func(kid, alg string) (any, error) {
+		return key, nil
+	})
+}
+
+// JWTOptions 配置 JWT 认证器
+type JWTOptions struct {
+	// Keys 校验签名的密钥
+	Keys KeySet
+	// Algorithms 允许的签名算法，默认允许所有支持的算法，"none" 永远不被允许
+	Algorithms []string
+	// Issuer 不为空时要求 iss 与之相等
+	Issuer string
+	// Audience 不为空时要求 aud 包含它
+	Audience string
+	// Leeway 校验 exp 和 nbf 时允许的时钟偏差
+	Leeway time.Duration
+	// RolesClaim 角色所在的声明，默认为 "roles"
+	RolesClaim string
+	// Realm WWW-Authenticate 中的 realm
+	Realm string
+
+	now func() time.Time
+}
+
+// JWT 返回从 Authorization: Bearer 请求头中校验 JWT 的认证器
+// 支持 HS256/384/512、RS256/384/512、PS256/384/512 和 ES256/384/512，只依赖标准库
+// 权限范围从 scope (空格分隔) 或 scp (数组) 声明中读取
+func JWT(opts JWTOptions) Authenticator {
+	if opts.RolesClaim == "" {
+		opts.RolesClaim = "roles"
+	}
+	if opts.now == nil {
+		opts.now = time.Now
+	}
+	return &jwtAuth{opts: opts}
+}
+
+type jwtAuth struct {
+	opts JWTOptions
+}
+
+func (a *jwtAuth) Challenge() string {
+	if a.opts.Realm == "" {
+		return "Bearer"
+	}
+	return "Bearer realm=" + strconv.Quote(a.opts.Realm)
+}
+
+func (a *jwtAuth) Authenticate(r *http.Request) (*Principal, error) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return nil, ErrNoCredentials
+	}
+	claims, err := a.verify(strings.TrimSpace(token))
+	if err != nil {
+		return nil, err
+	}
+	p := &Principal{Scheme: "bearer", Claims: claims}
+	p.ID, _ = claims["sub"].(string)
+	if scope, ok := claims["scope"].(string); ok {
+		p.Scopes = strings.Fields(scope)
+	} else {
+		p.Scopes = stringList(claims["scp"])
+	}
+	p.Roles = stringList(claims[a.opts.RolesClaim])
+	return p, nil
+}
+
+// verify 校验签名和注册声明，返回全部声明
+func (a *jwtAuth) verify(token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalidToken("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, invalidToken("malformed header")
+	}
+	if header.Alg == "" || strings.EqualFold(header.Alg, "none") {
+		return nil, invalidToken("unsigned token")
+	}
+	if a.opts.Algorithms != nil && !contains(a.opts.Algorithms, header.Alg) {
+		return nil, invalidToken("algorithm %s is not allowed", header.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalidToken("malformed signature")
+	}
+	key, err := a.opts.Keys.Key(header.Kid, header.Alg)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(base64.NewDecoder(base64.RawURLEncoding, strings.NewReader(parts[1])))
+	dec.UseNumber()
+	var claims map[string]any
+	if err := dec.Decode(&claims); err != nil {
+		return nil, invalidToken("malformed claims")
+	}
+	if err := a.validateClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// validateClaims 校验 exp、nbf、iss 和 aud
+func (a *jwtAuth) validateClaims(claims map[string]any) error {
+	now := a.opts.now()
+	if exp, ok, err := numericDate(claims, "exp"); err != nil {
+		return err
+	} else if ok && !now.Before(exp.Add(a.opts.Leeway)) {
+		return invalidToken("token is expired")
+	}
+	if nbf, ok, err := numericDate(claims, "nbf"); err != nil {
+		return err
+	} else if ok && now.Add(a.opts.Leeway).Before(nbf) {
+		return invalidToken("token is not valid yet")
+	}
+	if a.opts.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != a.opts.Issuer {
+			return invalidToken("unexpected issuer")
+		}
+	}
+	if a.opts.Audience != "" {
+		aud := stringList(claims["aud"])
+		if s, ok := claims["aud"].(string); ok {
+			aud = []string{s}
+		}
+		if !contains(aud, a.opts.Audience) {
+			return invalidToken("unexpected audience")
+		}
+	}
+	return nil
+}
+
+// verifySignature 校验签名，密钥类型必须与算法一致，防止算法混淆
+func verifySignature(alg string, key any, signed string, sig []byte) error {
+	if len(alg) != 5 {
+		return invalidToken("unsupported algorithm %s", alg)
+	}
+	var h crypto.Hash
+	switch alg[2:] {
+	case "256":
+		h = crypto.SHA256
+	case "384":
+		h = crypto.SHA384
+	case "512":
+		h = crypto.SHA512
+	default:
+		return invalidToken("unsupported algorithm %s", alg)
+	}
+	switch alg[:2] {
+	case "HS":
+		secret, ok := key.([]byte)
+		if !ok {
+			return invalidToken("key does not match algorithm %s", alg)
+		}
+		mac := hmac.New(hashFunc(h), secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return invalidToken("signature is invalid")
+		}
+		return nil
+	case "RS", "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return invalidToken("key does not match algorithm %s", alg)
+		}
+		digest := sum(h, signed)
+		var err error
+		if alg[0] == 'R' {
+			err = rsa.VerifyPKCS1v15(pub, h, digest, sig)
+		} else {
+			err = rsa.VerifyPSS(pub, h, digest, sig, nil)
+		}
+		if err != nil {
+			return invalidToken("signature is invalid")
+		}
+		return nil
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || !curveMatches(alg, pub) {
+			return invalidToken("key does not match algorithm %s", alg)
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return invalidToken("signature is invalid")
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, sum(h, signed), r, s) {
+			return invalidToken("signature is invalid")
+		}
+		return nil
+	}
+	return invalidToken("unsupported algorithm %s", alg)
+}
+
+// curveMatches ES256 使用 P-256，ES384 使用 P-384，ES512 使用 P-521
+func curveMatches(alg string, pub *ecdsa.PublicKey) bool {
+	name := pub.Curve.Params().Name
+	switch alg {
+	case "ES256":
+		return name == "P-256"
+	case "ES384":
+		return name == "P-384"
+	case "ES512":
+		return name == "P-521"
+	}
+	return false
+}
+
+func hashFunc(h crypto.Hash) func() hash.Hash {
+	switch h {
+	case crypto.SHA384:
+		return sha512.New384
+	case crypto.SHA512:
+		return sha512.New
+	}
+	return sha256.New
+}
+
+func sum(h crypto.Hash, s string) []byte {
+	hh := hashFunc(h)()
+	hh.Write([]byte(s))
+	return hh.Sum(nil)
+}
+
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// maxNumericDate 时间声明允许的最大秒数，更大的值无法安全地转换为 time.Time
+const maxNumericDate = 1 << 53
+
+// numericDate 读取时间声明，声明存在但不是有限的数字或超出范围时返回错误
+func numericDate(claims map[string]any, name string) (time.Time, bool, error) {
+	v, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false, invalidToken("%s is not a number", name)
+	}
+	f, err := n.Float64()
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return time.Time{}, false, invalidToken("%s is not a number", name)
+	}
+	if math.Abs(f) > maxNumericDate {
+		return time.Time{}, false, invalidToken("%s is out of range", name)
+	}
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*1e9)), true, nil
+}
+
+// stringList 将字符串数组声明转换为 []string
+func stringList(v any) []string {
+	list, ok := v.([]any)
+	if !ok {
+		return nil
+	}
+	out := make([]string, 0, len(list))
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func invalidToken(format string, args ...any) error {
+	return fmt.Errorf("%w: "+format, append([]any{ErrInvalidToken}, args...)...)
+}
@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testNow = time.Unix(1700000000, 0)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// sign 生成测试用的 JWT
+func sign(t *testing.T, alg, kid string, key any, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	var err error
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		if alg == "PS256" {
+			sig, err = rsa.SignPSS(rand.Reader, k, crypto.SHA256, digest[:], nil)
+		} else {
+			sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		}
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k, digest[:])
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + b64(sig)
+}
+
+func authenticate(a Authenticator, token string) (*Principal, error) {
+	req := httptest.NewRequest("GET", "/", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return a.Authenticate(req)
+}
+
+func TestJWT(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("secret")
+	keys := KeySetFunc(func(kid, alg string) (any, error) {
+		switch kid {
+		case "hs":
+			return secret, nil
+		case "rs":
+			return &rsaKey.PublicKey, nil
+		case "es":
+			return &ecKey.PublicKey, nil
+		}
+		return nil, errors.New("unknown kid")
+	})
+	a := JWT(JWTOptions{Keys: keys, Issuer: "https://issuer", Audience: "api", now: func() time.Time { return testNow }})
+
+	claims := func(extra map[string]any) map[string]any {
+		c := map[string]any{
+			"sub":   "alice",
+			"iss":   "https://issuer",
+			"aud":   []string{"api", "other"},
+			"exp":   testNow.Add(time.Hour).Unix(),
+			"scope": "orders:read orders:write",
+			"roles": []string{"admin"},
+		}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+
+	valid := []string{
+		sign(t, "HS256", "hs", secret, claims(nil)),
+		sign(t, "RS256", "rs", rsaKey, claims(nil)),
+		sign(t, "PS256", "rs", rsaKey, claims(nil)),
+		sign(t, "ES256", "es", ecKey, claims(nil)),
+		sign(t, "HS256", "hs", secret, claims(map[string]any{"exp": 10000000000})),
+		sign(t, "HS256", "hs", secret, claims(map[string]any{"exp": 253402300799})),
+		sign(t, "HS256", "hs", secret, claims(map[string]any{"exp": json.Number("253402300799.5")})),
+	}
+	for _, token := range valid {
+		p, err := authenticate(a, token)
+		if err != nil {
+			t.Errorf("Expected valid token, got %v", err)
+			continue
+		}
+		if p.ID != "alice" || !p.HasScope("orders:write") || !p.HasRole("admin") || p.Scheme != "bearer" {
+			t.Errorf("Unexpected principal %+v", p)
+		}
+	}
+
+	invalid := map[string]string{
+		"expired":        sign(t, "HS256", "hs", secret, claims(map[string]any{"exp": testNow.Unix()})),
+		"not yet valid":  sign(t, "HS256", "hs", secret, claims(map[string]any{"nbf": testNow.Add(time.Minute).Unix()})),
+		"far future nbf": sign(t, "HS256", "hs", secret, claims(map[string]any{"nbf": 1e13})),
+		"exp overflow":   sign(t, "HS256", "hs", secret, claims(map[string]any{"exp": json.Number("1e300")})),
+		"exp too large":  sign(t, "HS256", "hs", secret, claims(map[string]any{"exp": json.Number("1e400")})),
+		"issuer":         sign(t, "HS256", "hs", secret, claims(map[string]any{"iss": "https://evil"})),
+		"audience":       sign(t, "HS256", "hs", secret, claims(map[string]any{"aud": "other"})),
+		"wrong secret":   sign(t, "HS256", "hs", []byte("guess"), claims(nil)),
+		"none":           sign(t, "none", "hs", nil, claims(nil)),
+		"alg confusion":  sign(t, "HS256", "rs", secret, claims(nil)),
+		"curve mismatch": sign(t, "ES384", "es", ecKey, claims(nil)),
+		"unknown kid":    sign(t, "HS256", "xx", secret, claims(nil)),
+		"malformed":      "abc.def",
+	}
+	for name, token := range invalid {
+		if _, err := authenticate(a, token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+	if _, err := authenticate(a, ""); err != ErrNoCredentials {
+		t.Errorf("Expected ErrNoCredentials, got %v", err)
+	}
+
+	restricted := JWT(JWTOptions{Keys: keys, Algorithms: []string{"RS256"}, now: func() time.Time { return testNow }})
+	if _, err := authenticate(restricted, valid[0]); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected disallowed algorithm to fail, got %v", err)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, _ := json.Marshal(map[string]any{"keys": []map[string]string{
+		{"kty": "oct", "kid": "hs", "k": b64([]byte("secret"))},
+		{"kty": "EC", "kid": "es", "alg": "ES256", "crv": "P-256",
+			"x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+	}})
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, doc, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fromFile, err := LoadJWKSFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromHandler, err := LoadJWKSHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(doc)
+	}), "https://issuer/.well-known/jwks.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := map[string]any{"sub": "alice", "exp": testNow.Add(time.Hour).Unix()}
+	for _, set := range []*JWKS{fromFile, fromHandler} {
+		a := JWT(JWTOptions{Keys: set, now: func() time.Time { return testNow }})
+		for _, token := range []string{
+			sign(t, "ES256", "es", ecKey, claims),
+			sign(t, "HS256", "hs", []byte("secret"), claims),
+		} {
+			if _, err := authenticate(a, token); err != nil {
+				t.Errorf("Expected token to verify with JWKS, got %v", err)
+			}
+		}
+		if _, err := authenticate(a, sign(t, "HS256", "enc", []byte("secret"), claims)); err == nil {
+			t.Errorf("Expected encryption key to be ignored")
+		}
+	}
+
+	if _, err := ParseJWKS([]byte(`{"keys":[{"kty":"EC","crv":"P-256","x":"AAAA","y":"AAAA"}]}`)); err == nil {
+		t.Errorf("Expected invalid EC key to fail")
+	}
+	if _, err := LoadJWKSHandler(http.NotFoundHandler(), "https://issuer/jwks"); err == nil {
+		t.Errorf("Expected error for non-200 response")
+	}
+}
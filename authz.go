@@ -0,0 +1,164 @@
+package mux
+
+import (
+	"net/http"
+	"strings"
+)
+
+// PolicyFunc 授权规则，p 不为nil，可以通过 mux.Vars 读取路由变量
+type PolicyFunc func(r *http.Request, p Principal) bool
+
+// policy 带有描述的授权规则，描述用于审计
+type policy struct {
+	desc  string
+	allow PolicyFunc
+}
+
+// Require 要求主体拥有全部给定的权限范围
+func (r *Route) Require(scopes ...string) *Route {
+	r.requiredScopes = append(r.requiredScopes, scopes...)
+	return r.addPolicy("scope:"+strings.Join(scopes, ","), func(req *http.Request, p Principal) bool {
+		for _, s := range scopes {
+			if !p.HasScope(s) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// RequireRole 要求主体拥有给定角色中的任意一个
+func (r *Route) RequireRole(roles ...string) *Route {
+	return r.addPolicy("role:"+strings.Join(roles, "|"), func(req *http.Request, p Principal) bool {
+		for _, role := range roles {
+			if p.HasRole(role) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Allow 添加自定义授权规则，desc 出现在审计报告中，示例:
+//
+//	r.HandleFunc("/users/{userID}/orders", OrdersHandler).
+//	  Allow("self", mux.SubjectVar("userID"))
+func (r *Route) Allow(desc string, f PolicyFunc) *Route {
+	return r.addPolicy(desc, f)
+}
+
+// Public 声明路由不需要认证，auth.Middleware 允许没有凭据的请求匿名访问，审计时不会被报告为缺少授权规则
+// 它只对当前路由生效，不会被子路由器中的路由继承，路由的授权规则仍然会被执行
+func (r *Route) Public() *Route {
+	r.public = true
+	return r
+}
+
+// addPolicy 添加授权规则，在 Subrouter 之前添加的规则会被子路由器中的路由继承
+func (r *Route) addPolicy(desc string, f PolicyFunc) *Route {
+	r.policies = append(r.policies, policy{desc: desc, allow: f})
+	return r
+}
+
+// GetRequiredScopes 返回通过 Require 声明的权限范围
+func (r *Route) GetRequiredScopes() []string {
+	return r.requiredScopes
+}
+
+// GetPolicies 返回路由授权规则的描述
+func (r *Route) GetPolicies() []string {
+	descs := make([]string, len(r.policies))
+	for i, p := range r.policies {
+		descs[i] = p.desc
+	}
+	return descs
+}
+
+// IsPublic 如果路由通过 Public 声明不需要认证，则返回true
+func (r *Route) IsPublic() bool {
+	return r.public
+}
+
+// SubjectVar 要求给定的路由变量等于主体的标识，如只能访问自己的 {userID}
+func SubjectVar(name string) PolicyFunc {
+	return func(r *http.Request, p Principal) bool {
+		v, ok := Vars(r)[name]
+		return ok && v != "" && v == p.Subject()
+	}
+}
+
+// AuthorizeOptions 配置 Authorize 中间件
+type AuthorizeOptions struct {
+	// ErrorHandler 写出401和403响应，默认写出状态码对应的文本
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, code int)
+}
+
+// Authorize 返回执行路由授权规则的中间件，应该通过 Router.Use 注册在认证中间件之后
+// 路由有授权规则而请求中没有主体时返回401，任意规则不满足时返回403，即使路由声明为 Public
+// 没有授权规则的路由不做检查，可以通过 AuditPolicies 找出它们
+func Authorize(opts AuthorizeOptions) MiddlewareFunc {
+	fail := func(w http.ResponseWriter, r *http.Request, code int) {
+		if opts.ErrorHandler != nil {
+			opts.ErrorHandler(w, r, code)
+			return
+		}
+		http.Error(w, http.StatusText(code), code)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			route := CurrentRoute(req)
+			if route == nil || len(route.policies) == 0 {
+				next.ServeHTTP(w, req)
+				return
+			}
+			p := PrincipalFromContext(req.Context())
+			if p == nil {
+				fail(w, req, http.StatusUnauthorized)
+				return
+			}
+			for _, pol := range route.policies {
+				if !pol.allow(req, p) {
+					fail(w, req, http.StatusForbidden)
+					return
+				}
+			}
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// PolicyAudit 审计报告中的一个路由
+type PolicyAudit struct {
+	Route        *Route
+	Name         string
+	PathTemplate string
+	Methods      []string
+	Policies     []string
+	Public       bool
+}
+
+// Unprotected 如果路由既没有授权规则也没有声明为公开，则返回true
+func (a PolicyAudit) Unprotected() bool {
+	return !a.Public && len(a.Policies) == 0
+}
+
+// AuditPolicies 通过 Walk 列出所有设置了处理器的路由及其授权规则
+func (r *Router) AuditPolicies() []PolicyAudit {
+	var report []PolicyAudit
+	r.Walk(func(route *Route, router *Router, ancestors []*Route) error {
+		if route.GetHandler() == nil {
+			return nil
+		}
+		a := PolicyAudit{
+			Route:    route,
+			Name:     route.GetName(),
+			Policies: route.GetPolicies(),
+			Public:   route.IsPublic(),
+		}
+		a.PathTemplate, _ = route.GetPathTemplate()
+		a.Methods, _ = route.GetMethods()
+		report = append(report, a)
+		return nil
+	})
+	return report
+}
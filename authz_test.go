@@ -0,0 +1,109 @@
+package mux
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func (p *testPrincipal) HasScope(s string) bool { return containsString(p.scopes, s) }
+
+func (p *testPrincipal) HasRole(r string) bool { return containsString(p.roles, r) }
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// withTestPrincipal 模拟认证中间件
+func withTestPrincipal(p Principal) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if p != nil {
+				r = r.WithContext(WithPrincipal(r.Context(), p))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	alice := &testPrincipal{id: "alice", scopes: []string{"orders:read"}}
+	admin := &testPrincipal{id: "root", scopes: []string{"orders:read", "orders:write"}, roles: []string{"admin"}}
+
+	newRouter := func(p Principal) *Router {
+		router := NewRouter()
+		router.HandleFunc("/health", stringHandler("ok")).Public()
+		router.HandleFunc("/orders", stringHandler("list")).Methods("GET").Require("orders:read")
+		router.HandleFunc("/orders", stringHandler("create")).Methods("POST").Require("orders:read", "orders:write")
+		router.HandleFunc("/users/{userID}", stringHandler("user")).Allow("self", SubjectVar("userID"))
+		adminRouter := router.PathPrefix("/admin").RequireRole("admin", "support").Subrouter()
+		adminRouter.HandleFunc("/stats", stringHandler("stats"))
+		// Public 不会被继承，也不会跳过授权规则
+		pubRouter := router.PathPrefix("/pub").Public().Subrouter()
+		pubRouter.HandleFunc("/admin", stringHandler("pub admin")).RequireRole("admin")
+		pubRouter.HandleFunc("/open", stringHandler("pub open"))
+		router.HandleFunc("/reports", stringHandler("reports")).Require("orders:write").Public()
+		router.HandleFunc("/legacy", stringHandler("legacy"))
+		router.Use(withTestPrincipal(p), Authorize(AuthorizeOptions{}))
+		return router
+	}
+
+	tests := []struct {
+		principal Principal
+		method    string
+		path      string
+		expCode   int
+	}{
+		{nil, "GET", "/health", http.StatusOK},
+		{nil, "GET", "/legacy", http.StatusOK},
+		{nil, "GET", "/orders", http.StatusUnauthorized},
+		{alice, "GET", "/orders", http.StatusOK},
+		{alice, "POST", "/orders", http.StatusForbidden},
+		{admin, "POST", "/orders", http.StatusOK},
+		{alice, "GET", "/users/alice", http.StatusOK},
+		{alice, "GET", "/users/bob", http.StatusForbidden},
+		{alice, "GET", "/admin/stats", http.StatusForbidden},
+		{admin, "GET", "/admin/stats", http.StatusOK},
+		{nil, "GET", "/pub/admin", http.StatusUnauthorized},
+		{alice, "GET", "/pub/admin", http.StatusForbidden},
+		{admin, "GET", "/pub/admin", http.StatusOK},
+		{nil, "GET", "/pub/open", http.StatusOK},
+		{nil, "GET", "/reports", http.StatusUnauthorized},
+		{alice, "GET", "/reports", http.StatusForbidden},
+		{admin, "GET", "/reports", http.StatusOK},
+	}
+	for _, test := range tests {
+		rw := NewRecorder()
+		newRouter(test.principal).ServeHTTP(rw, newRequest(test.method, test.path))
+		if rw.Code != test.expCode {
+			t.Errorf("%v %s %s: expected %d, got %d", test.principal, test.method, test.path, test.expCode, rw.Code)
+		}
+	}
+
+	var unprotected []string
+	for _, a := range newRouter(nil).AuditPolicies() {
+		if a.Unprotected() {
+			unprotected = append(unprotected, a.PathTemplate)
+		}
+		if a.PathTemplate == "/admin/stats" && !reflect.DeepEqual(a.Policies, []string{"role:admin|support"}) {
+			t.Errorf("Expected inherited role policy, got %v", a.Policies)
+		}
+		if a.PathTemplate == "/pub/admin" && (a.Public || !reflect.DeepEqual(a.Policies, []string{"role:admin"})) {
+			t.Errorf("Expected role policy without inherited Public, got %v %v", a.Public, a.Policies)
+		}
+		if a.PathTemplate == "/reports" && (!a.Public || !reflect.DeepEqual(a.Policies, []string{"scope:orders:write"})) {
+			t.Errorf("Expected public route with scope policy, got %v %v", a.Public, a.Policies)
+		}
+		if a.PathTemplate == "/orders" && a.Methods[0] == "POST" && !reflect.DeepEqual(a.Policies, []string{"scope:orders:read,orders:write"}) {
+			t.Errorf("Unexpected policies %v", a.Policies)
+		}
+	}
+	if !reflect.DeepEqual(unprotected, []string{"/pub/open", "/legacy"}) {
+		t.Errorf("Expected /pub/open and /legacy to be unprotected, got %v", unprotected)
+	}
+}
@@ -0,0 +1,62 @@
+package mux
+
+import (
+	"net/http"
+)
+
+// MaxBodyBytes 设置新路由请求体的最大字节数，子路由会继承此设置，0表示不限制
+// 参考 Route.MaxBodyBytes()
+func (r *Router) MaxBodyBytes(n int64) *Router {
+	r.maxBodyBytes = n
+	return r
+}
+
+// MaxBodyBytes 设置路由请求体的最大字节数，覆盖路由器的默认值，0表示不限制
+// Content-Length 超出限制的请求在匹配后立即被拒绝并返回413，不会运行中间件和处理器，
+// 其余请求的 Body 被 http.MaxBytesReader 包裹，读取超出限制时返回 *http.MaxBytesError
+func (r *Route) MaxBodyBytes(n int64) *Route {
+	r.maxBodyBytes = n
+	return r
+}
+
+// GetMaxBodyBytes 返回路由生效的请求体最大字节数，0表示不限制
+func (r *Route) GetMaxBodyBytes() int64 {
+	if r.maxBodyBytes < 0 {
+		return 0
+	}
+	return r.maxBodyBytes
+}
+
+// bodyTooLarge 报告请求的 Content-Length 是否超出路由的限制
+func (r *Route) bodyTooLarge(req *http.Request) bool {
+	n := r.GetMaxBodyBytes()
+	return n > 0 && req.ContentLength > n
+}
+
+// entityTooLarge 使用状态码413响应请求并关闭连接，避免读取剩余的请求体
+func entityTooLarge(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Connection", "close")
+	http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+}
+
+// withBodyLimit 为最终匹配的路由的处理器加上请求体大小限制
+// ServeHTTP 在运行中间件之前已经拒绝了 Content-Length 超出限制的请求，这里处理直接使用 Match 的调用方
+func (r *Route) withBodyLimit(h http.Handler) http.Handler {
+	n := r.GetMaxBodyBytes()
+	if n == 0 || h == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if r.bodyTooLarge(req) {
+			entityTooLarge(w, req)
+			return
+		}
+		if req.Body != nil && req.Body != http.NoBody {
+			r2 := new(http.Request)
+			*r2 = *req
+			r2.Body = http.MaxBytesReader(w, req.Body, n)
+			req = r2
+		}
+		h.ServeHTTP(w, req)
+	})
+}
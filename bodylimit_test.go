@@ -0,0 +1,87 @@
+package mux
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMaxBodyBytes(t *testing.T) {
+	var readErr error
+	read := func(w http.ResponseWriter, r *http.Request) {
+		_, readErr = io.ReadAll(r.Body)
+		if readErr != nil {
+			return
+		}
+		w.Write([]byte("ok"))
+	}
+	router := NewRouter().MaxBodyBytes(8)
+	router.HandleFunc("/json", read)
+	router.HandleFunc("/upload", read).MaxBodyBytes(1 << 20)
+	api := router.PathPrefix("/api").Subrouter()
+	api.HandleFunc("/unlimited", read).MaxBodyBytes(0)
+
+	tests := []struct {
+		path          string
+		body          string
+		contentLength int64
+		expCode       int
+		expTooLarge   bool
+	}{
+		{"/json", "small", 5, http.StatusOK, false},
+		{"/json", "far too large", 13, http.StatusRequestEntityTooLarge, false},
+		{"/json", "far too large", -1, 0, true},
+		{"/upload", "far too large", 13, http.StatusOK, false},
+		{"/api/unlimited", "far too large", 13, http.StatusOK, false},
+	}
+	for _, test := range tests {
+		readErr = nil
+		req := newRequest("POST", test.path)
+		req.Body = io.NopCloser(strings.NewReader(test.body))
+		req.ContentLength = test.contentLength
+		rw := NewRecorder()
+		router.ServeHTTP(rw, req)
+		if rw.Code != test.expCode {
+			t.Errorf("%s %d: expected %d, got %d", test.path, test.contentLength, test.expCode, rw.Code)
+		}
+		var maxErr *http.MaxBytesError
+		if errors.As(readErr, &maxErr) != test.expTooLarge {
+			t.Errorf("%s %d: unexpected read error %v", test.path, test.contentLength, readErr)
+		}
+	}
+
+	var limits []int64
+	router.Walk(func(route *Route, router *Router, ancestors []*Route) error {
+		limits = append(limits, route.GetMaxBodyBytes())
+		return nil
+	})
+	if len(limits) != 4 || limits[0] != 8 || limits[1] != 1<<20 || limits[3] != 0 {
+		t.Errorf("Unexpected limits from Walk: %v", limits)
+	}
+}
+
+func TestMaxBodyBytesBeforeMiddleware(t *testing.T) {
+	var ran bool
+	router := NewRouter().MaxBodyBytes(8)
+	router.HandleFunc("/json", dummyHandler)
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ran = true
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	req := newRequest("POST", "/json")
+	req.Body = io.NopCloser(strings.NewReader("far too large"))
+	req.ContentLength = 13
+	rw := NewRecorder()
+	router.ServeHTTP(rw, req)
+	if rw.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected %d, got %d", http.StatusRequestEntityTooLarge, rw.Code)
+	}
+	if ran {
+		t.Error("Expected middleware not to run for an oversized request")
+	}
+}
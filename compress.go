@@ -0,0 +1,357 @@
+package mux
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MetadataNoCompression 路由元数据中关闭压缩的键，值为 true 时 Compress 不压缩该路由的响应
+// 适用于 SSE 或已经压缩的下载
+const MetadataNoCompression = "mux.nocompress"
+
+// defaultCompressMinSize 默认的最小压缩大小
+const defaultCompressMinSize = 1024
+
+// Encoder 压缩编码，可以通过实现此接口接入 br、zstd 等编码
+// NewWriter 返回的 writer 如果实现了 Flush() error，响应 Flush 时会调用它
+type Encoder interface {
+	// Encoding 返回 Content-Encoding 中的名称，如 "gzip"
+	Encoding() string
+	// NewWriter 返回将压缩后的数据写入 w 的 writer
+	NewWriter(w io.Writer) io.WriteCloser
+}
+
+// CompressOptions 配置 Compress 中间件
+type CompressOptions struct {
+	// Encoders 可用的编码，q 值相同时靠前的优先，默认为 gzip 和 deflate
+	Encoders []Encoder
+	// MinSize 小于此大小的响应不压缩，默认为1024字节
+	MinSize int
+}
+
+// Compress 返回根据 Accept-Encoding 压缩响应的中间件
+// 已经设置了 Content-Encoding、类型为已压缩格式或小于 MinSize 的响应不会被压缩，
+// 路由元数据中 MetadataNoCompression 为 true 时不压缩
+func Compress(opts CompressOptions) MiddlewareFunc {
+	if opts.Encoders == nil {
+		opts.Encoders = []Encoder{GzipEncoder(gzip.DefaultCompression), DeflateEncoder(flate.DefaultCompression)}
+	}
+	if opts.MinSize <= 0 {
+		opts.MinSize = defaultCompressMinSize
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			req, rec := withMatchRecord(req)
+			cw := &compressWriter{
+				ResponseWriter: w,
+				req:            req,
+				rec:            rec,
+				opts:           &opts,
+				encoder:        negotiateEncoding(req.Header.Values("Accept-Encoding"), opts.Encoders),
+			}
+			defer cw.close()
+			next.ServeHTTP(cw, req)
+		})
+	}
+}
+
+// GzipEncoder 返回给定压缩级别的 gzip 编码，级别无效时 panic
+func GzipEncoder(level int) Encoder {
+	if _, err := gzip.NewWriterLevel(io.Discard, level); err != nil {
+		panic(fmt.Sprintf("mux: invalid gzip compression level %d", level))
+	}
+	return newPoolEncoder("gzip", func() resetWriter {
+		w, _ := gzip.NewWriterLevel(io.Discard, level)
+		return w
+	})
+}
+
+// DeflateEncoder 返回给定压缩级别的 deflate 编码，级别无效时 panic
+func DeflateEncoder(level int) Encoder {
+	if _, err := flate.NewWriter(io.Discard, level); err != nil {
+		panic(fmt.Sprintf("mux: invalid deflate compression level %d", level))
+	}
+	return newPoolEncoder("deflate", func() resetWriter {
+		w, _ := flate.NewWriter(io.Discard, level)
+		return w
+	})
+}
+
+// resetWriter 可以复用的压缩 writer，如 gzip.Writer 和 flate.Writer
+type resetWriter interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// poolEncoder 通过 sync.Pool 复用压缩 writer
+type poolEncoder struct {
+	encoding string
+	pool     sync.Pool
+}
+
+func newPoolEncoder(encoding string, newWriter func() resetWriter) *poolEncoder {
+	e := &poolEncoder{encoding: encoding}
+	e.pool.New = func() any { return newWriter() }
+	return e
+}
+
+func (e *poolEncoder) Encoding() string {
+	return e.encoding
+}
+
+func (e *poolEncoder) NewWriter(w io.Writer) io.WriteCloser {
+	zw := e.pool.Get().(resetWriter)
+	zw.Reset(w)
+	return &pooledWriter{resetWriter: zw, pool: &e.pool}
+}
+
+type pooledWriter struct {
+	resetWriter
+	pool *sync.Pool
+}
+
+func (w *pooledWriter) Close() error {
+	err := w.resetWriter.Close()
+	w.resetWriter.Reset(io.Discard)
+	w.pool.Put(w.resetWriter)
+	return err
+}
+
+// negotiateEncoding 根据 Accept-Encoding 中的 q 值选择编码，没有可接受的编码时返回nil
+func negotiateEncoding(values []string, encoders []Encoder) Encoder {
+	if len(values) == 0 {
+		return nil
+	}
+	q := make(map[string]float64)
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			name, params, _ := strings.Cut(part, ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			weight := 1.0
+			for _, param := range strings.Split(params, ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+				if ok && strings.EqualFold(key, "q") {
+					if f, err := strconv.ParseFloat(value, 64); err == nil && f >= 0 && f <= 1 {
+						weight = f
+					} else {
+						weight = 0
+					}
+				}
+			}
+			q[name] = weight
+		}
+	}
+	var best Encoder
+	var bestQ float64
+	for _, e := range encoders {
+		weight, ok := q[strings.ToLower(e.Encoding())]
+		if !ok {
+			weight = q["*"]
+		}
+		if weight > bestQ {
+			best, bestQ = e, weight
+		}
+	}
+	return best
+}
+
+// compressedTypes 已经压缩的内容类型前缀
+var compressedTypes = []string{
+	"image/", "video/", "audio/", "font/woff",
+	"application/zip", "application/gzip", "application/x-gzip", "application/zstd",
+	"application/x-7z-compressed", "application/x-rar-compressed", "application/x-bzip2",
+}
+
+// compressibleType 如果内容类型适合压缩，则返回true
+func compressibleType(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	if strings.HasPrefix(contentType, "image/svg+xml") {
+		return true
+	}
+	for _, prefix := range compressedTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// compressWriter 缓冲响应的开头，达到 MinSize 或结束时决定是否压缩
+type compressWriter struct {
+	http.ResponseWriter
+	req     *http.Request
+	rec     *matchRecord
+	opts    *CompressOptions
+	encoder Encoder
+
+	code    int
+	buf     []byte
+	decided bool
+	zw      io.WriteCloser
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.decided || w.code != 0 {
+		if w.decided && w.zw == nil {
+			w.ResponseWriter.WriteHeader(code)
+		}
+		return
+	}
+	// 1xx 信息响应直接写出
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.code = code
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		if w.code == 0 {
+			w.code = http.StatusOK
+		}
+		if len(w.buf)+len(b) < w.opts.MinSize {
+			w.buf = append(w.buf, b...)
+			return len(b), nil
+		}
+		if err := w.decide(append(w.buf, b...)); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if w.zw != nil {
+		return w.zw.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// decide 写出响应头和已缓冲的数据，足够大的响应开始压缩
+func (w *compressWriter) decide(data []byte) error {
+	w.decided = true
+	w.buf = nil
+	h := w.Header()
+	if w.compressible(h, len(data)) {
+		if h.Get("Content-Type") == "" {
+			h.Set("Content-Type", http.DetectContentType(data))
+		}
+		if compressibleType(h.Get("Content-Type")) {
+			h.Del("Content-Length")
+			h.Set("Content-Encoding", w.encoder.Encoding())
+			// 压缩后的表示不再逐字节相同
+			if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+				h.Set("ETag", "W/"+etag)
+			}
+			w.zw = w.encoder.NewWriter(w.ResponseWriter)
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.code)
+	if len(data) == 0 {
+		return nil
+	}
+	var err error
+	if w.zw != nil {
+		_, err = w.zw.Write(data)
+	} else {
+		_, err = w.ResponseWriter.Write(data)
+	}
+	return err
+}
+
+// compressible 根据路由、状态码和响应头判断是否可以压缩，需要时添加 Vary
+func (w *compressWriter) compressible(h http.Header, size int) bool {
+	if route, _ := w.rec.matched(w.req); route != nil {
+		if off, _ := route.GetMetadataValueOr(MetadataNoCompression, false).(bool); off {
+			return false
+		}
+	}
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	if !headerContains(h, "Vary", "Accept-Encoding") {
+		h.Add("Vary", "Accept-Encoding")
+	}
+	if w.encoder == nil || size < w.opts.MinSize || w.req.Method == http.MethodHead {
+		return false
+	}
+	switch w.code {
+	case http.StatusNoContent, http.StatusNotModified, http.StatusPartialContent:
+		return false
+	}
+	return true
+}
+
+// headerContains 如果逗号分隔的请求头中包含给定的值，则返回true
+func headerContains(h http.Header, key, value string) bool {
+	for _, v := range h.Values(key) {
+		for _, s := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(s), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// close 在处理器返回后写出剩余的数据并结束压缩
+func (w *compressWriter) close() {
+	if !w.decided {
+		if w.code == 0 {
+			// 处理器没有写出任何内容，由外层决定响应
+			return
+		}
+		w.decide(w.buf)
+	}
+	if w.zw != nil {
+		w.zw.Close()
+		w.zw = nil
+	}
+}
+
+// Flush 决定是否压缩并刷新已写出的数据，流式响应在第一次 Flush 时数据通常还很小，不会被压缩
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if w.code == 0 {
+			w.code = http.StatusOK
+		}
+		w.decide(w.buf)
+	}
+	if f, ok := w.zw.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack 接管连接，之后不再写出任何响应
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("mux: response writer does not support hijacking")
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		w.decided = true
+		w.code = 0
+		w.buf = nil
+	}
+	return conn, rw, err
+}
+
+// Unwrap 返回被包裹的 ResponseWriter，供 http.ResponseController 使用
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
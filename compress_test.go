@@ -0,0 +1,131 @@
+package mux
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	big := strings.Repeat("hello world ", 200)
+	router := NewRouter()
+	router.HandleFunc("/big", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Length", "2400")
+		io.WriteString(w, big[:100])
+		io.WriteString(w, big[100:])
+	})
+	router.HandleFunc("/small", stringHandler("small"))
+	router.HandleFunc("/png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		io.WriteString(w, big)
+	})
+	router.HandleFunc("/encoded", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "br")
+		io.WriteString(w, big)
+	})
+	router.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, big)
+	}).Metadata(MetadataNoCompression, true)
+	router.Use(Compress(CompressOptions{}))
+
+	rw := NewRecorder()
+	router.ServeHTTP(rw, newRequestWithHeaders("GET", "/big", "Accept-Encoding", "gzip, deflate"))
+	if rw.HeaderMap.Get("Content-Encoding") != "gzip" || rw.HeaderMap.Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("Expected gzip response, got %v", rw.HeaderMap)
+	}
+	if rw.HeaderMap.Get("Content-Length") != "" || rw.HeaderMap.Get("ETag") != `W/"v1"` {
+		t.Errorf("Unexpected headers %v", rw.HeaderMap)
+	}
+	if !strings.HasPrefix(rw.HeaderMap.Get("Content-Type"), "text/plain") {
+		t.Errorf("Expected sniffed Content-Type, got %q", rw.HeaderMap.Get("Content-Type"))
+	}
+	zr, err := gzip.NewReader(rw.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(zr); string(body) != big {
+		t.Errorf("Unexpected decompressed body of length %d", len(body))
+	}
+
+	rw = NewRecorder()
+	router.ServeHTTP(rw, newRequestWithHeaders("GET", "/big", "Accept-Encoding", "gzip;q=0.5, deflate"))
+	if rw.HeaderMap.Get("Content-Encoding") != "deflate" {
+		t.Fatalf("Expected deflate response, got %v", rw.HeaderMap)
+	}
+	if body, _ := io.ReadAll(flate.NewReader(rw.Body)); string(body) != big {
+		t.Errorf("Unexpected decompressed body of length %d", len(body))
+	}
+
+	tests := []struct {
+		path           string
+		acceptEncoding string
+		expVary        bool
+	}{
+		{"/big", "", true},
+		{"/big", "identity", true},
+		{"/big", "gzip;q=0, deflate;q=0", true},
+		{"/small", "gzip", true},
+		{"/png", "gzip", true},
+		{"/encoded", "gzip", false},
+		{"/download", "gzip", false},
+	}
+	for _, test := range tests {
+		rw := NewRecorder()
+		router.ServeHTTP(rw, newRequestWithHeaders("GET", test.path, "Accept-Encoding", test.acceptEncoding))
+		if enc := rw.HeaderMap.Get("Content-Encoding"); enc != "" && enc != "br" {
+			t.Errorf("%s %q: expected no compression, got %q", test.path, test.acceptEncoding, enc)
+		}
+		if vary := rw.HeaderMap.Get("Vary") != ""; vary != test.expVary {
+			t.Errorf("%s %q: expected Vary %v, got %v", test.path, test.acceptEncoding, test.expVary, vary)
+		}
+		if rw.Code != http.StatusOK || rw.Body.Len() == 0 {
+			t.Errorf("%s %q: unexpected response %d %d", test.path, test.acceptEncoding, rw.Code, rw.Body.Len())
+		}
+	}
+}
+
+func TestCompressFlush(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: 1\n\n")
+		w.(http.Flusher).Flush()
+		io.WriteString(w, "data: 2\n\n")
+	})
+	router.UsePreMatch(Compress(CompressOptions{Encoders: []Encoder{GzipEncoder(gzip.BestSpeed)}}))
+
+	rw := NewRecorder()
+	router.ServeHTTP(rw, newRequestWithHeaders("GET", "/events", "Accept-Encoding", "*"))
+	if !rw.Flushed || rw.HeaderMap.Get("Content-Encoding") != "" {
+		t.Errorf("Expected flushed uncompressed stream, got %v", rw.HeaderMap)
+	}
+	if rw.Body.String() != "data: 1\n\ndata: 2\n\n" {
+		t.Errorf("Unexpected body %q", rw.Body.String())
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	gz, df := GzipEncoder(gzip.DefaultCompression), DeflateEncoder(flate.DefaultCompression)
+	encoders := []Encoder{gz, df}
+	tests := []struct {
+		accept string
+		exp    Encoder
+	}{
+		{"gzip", gz},
+		{"deflate, gzip", gz},
+		{"deflate;q=1, gzip;q=0.8", df},
+		{"GZIP;Q=0.1, *;q=0.5", df},
+		{"*;q=0", nil},
+		{"br", nil},
+		{"gzip;q=bogus, deflate", df},
+	}
+	for _, test := range tests {
+		if got := negotiateEncoding([]string{test.accept}, encoders); got != test.exp {
+			t.Errorf("%q: expected %v, got %v", test.accept, test.exp, got)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package mux
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MetadataConcurrencyLimit 路由元数据中并发限制的键，值为 ConcurrencyLimit
+//
+//	r.HandleFunc("/reports/{id}.pdf", PDFHandler).
+//	  Metadata(mux.MetadataConcurrencyLimit, mux.ConcurrencyLimit{MaxInFlight: 4, MaxQueue: 16, QueueTimeout: time.Second})
+const MetadataConcurrencyLimit = "mux.concurrency"
+
+// ConcurrencyLimit 限制同时处理的请求数，超出时排队等待
+type ConcurrencyLimit struct {
+	// Name 分组名称，名称相同的路由共享限制，为空时每个路由单独限制
+	// 同一分组使用第一个请求读取到的限制
+	Name string
+	// MaxInFlight 同时处理的最大请求数，不大于0时不限制
+	MaxInFlight int
+	// MaxQueue 等待队列的长度，为0时超出限制的请求立即被拒绝
+	MaxQueue int
+	// QueueTimeout 在队列中等待的最长时间，为0时一直等到请求被取消
+	QueueTimeout time.Duration
+}
+
+// ConcurrencyLimiterOptions 配置 ConcurrencyLimiter
+type ConcurrencyLimiterOptions struct {
+	// Default 路由没有在元数据中设置限制时使用的限制，零值表示不限制
+	Default ConcurrencyLimit
+	// RejectHandler 拒绝请求时使用的处理器，默认返回503
+	RejectHandler http.Handler
+	// Namespace 指标名称的前缀，默认为 "http"
+	Namespace string
+}
+
+// ConcurrencyLimiter 按路由或分组限制同时处理的请求数
+type ConcurrencyLimiter struct {
+	opts ConcurrencyLimiterOptions
+
+	mu     sync.RWMutex
+	groups map[string]*concurrencyGroup
+}
+
+type concurrencyGroup struct {
+	limit    ConcurrencyLimit
+	sem      chan struct{}
+	queued   atomic.Int64
+	rejected atomic.Uint64
+}
+
+// ConcurrencyStats 分组当前的状态
+type ConcurrencyStats struct {
+	Name     string
+	InFlight int
+	Queued   int
+	Rejected uint64
+}
+
+// NewConcurrencyLimiter 创建并发限制器
+func NewConcurrencyLimiter(opts ConcurrencyLimiterOptions) *ConcurrencyLimiter {
+	if opts.Namespace == "" {
+		opts.Namespace = "http"
+	}
+	return &ConcurrencyLimiter{opts: opts, groups: make(map[string]*concurrencyGroup)}
+}
+
+// Middleware 并发限制中间件，限制从 CurrentRoute 的元数据中读取，
+// 应该通过 Router.Use 注册在需要限制的路由器或子路由器上，同时注册在两者上时只计数一次
+func (l *ConcurrencyLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Context().Value(l) != nil {
+			next.ServeHTTP(w, req)
+			return
+		}
+		req = req.WithContext(context.WithValue(req.Context(), l, true))
+		g := l.group(req)
+		if g == nil {
+			next.ServeHTTP(w, req)
+			return
+		}
+		if !g.acquire(req.Context()) {
+			g.rejected.Add(1)
+			if l.opts.RejectHandler != nil {
+				l.opts.RejectHandler.ServeHTTP(w, req)
+				return
+			}
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		defer g.release()
+		next.ServeHTTP(w, req)
+	})
+}
+
+// group 返回请求所属的分组，不限制时返回nil
+func (l *ConcurrencyLimiter) group(req *http.Request) *concurrencyGroup {
+	limit := l.opts.Default
+	route := CurrentRoute(req)
+	if route != nil {
+		switch v := route.GetMetadataValueOr(MetadataConcurrencyLimit, nil).(type) {
+		case ConcurrencyLimit:
+			limit = v
+		case *ConcurrencyLimit:
+			limit = *v
+		}
+	}
+	if limit.MaxInFlight <= 0 {
+		return nil
+	}
+	name := limit.Name
+	if name == "" {
+		name = routeLabel(route)
+	}
+
+	l.mu.RLock()
+	g := l.groups[name]
+	l.mu.RUnlock()
+	if g != nil {
+		return g
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if g = l.groups[name]; g == nil {
+		g = &concurrencyGroup{limit: limit, sem: make(chan struct{}, limit.MaxInFlight)}
+		l.groups[name] = g
+	}
+	return g
+}
+
+// acquire 获取处理请求的许可，队列已满、等待超时或请求被取消时返回false
+func (g *concurrencyGroup) acquire(ctx context.Context) bool {
+	select {
+	case g.sem <- struct{}{}:
+		return true
+	default:
+	}
+	if g.queued.Add(1) > int64(g.limit.MaxQueue) {
+		g.queued.Add(-1)
+		return false
+	}
+	defer g.queued.Add(-1)
+
+	var timeout <-chan time.Time
+	if g.limit.QueueTimeout > 0 {
+		t := time.NewTimer(g.limit.QueueTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case g.sem <- struct{}{}:
+		return true
+	case <-timeout:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (g *concurrencyGroup) release() {
+	<-g.sem
+}
+
+// Stats 返回按名称排序的分组状态
+func (l *ConcurrencyLimiter) Stats() []ConcurrencyStats {
+	l.mu.RLock()
+	stats := make([]ConcurrencyStats, 0, len(l.groups))
+	for name, g := range l.groups {
+		stats = append(stats, ConcurrencyStats{
+			Name:     name,
+			InFlight: len(g.sem),
+			Queued:   int(g.queued.Load()),
+			Rejected: g.rejected.Load(),
+		})
+	}
+	l.mu.RUnlock()
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+// Handler 返回以文本格式输出各分组并发数、队列长度和拒绝次数的 Handler，格式与 Prometheus 兼容
+func (l *ConcurrencyLimiter) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		stats := l.Stats()
+		bw := bufio.NewWriter(w)
+		writeGroupMetric(bw, l.opts.Namespace+"_concurrency_in_flight", "gauge",
+			"Number of requests being served per concurrency group.", stats,
+			func(s ConcurrencyStats) string { return strconv.Itoa(s.InFlight) })
+		writeGroupMetric(bw, l.opts.Namespace+"_concurrency_queued", "gauge",
+			"Number of requests waiting per concurrency group.", stats,
+			func(s ConcurrencyStats) string { return strconv.Itoa(s.Queued) })
+		writeGroupMetric(bw, l.opts.Namespace+"_concurrency_rejected_total", "counter",
+			"Number of requests rejected per concurrency group.", stats,
+			func(s ConcurrencyStats) string { return strconv.FormatUint(s.Rejected, 10) })
+		bw.Flush()
+	})
+}
+
+func writeGroupMetric(w *bufio.Writer, name, typ, help string, stats []ConcurrencyStats, value func(ConcurrencyStats) string) {
+	writeMetricHeader(w, name, typ, help)
+	for _, s := range stats {
+		w.WriteString(name + `{group="` + escapeLabel(s.Name) + `"} ` + value(s) + "\n")
+	}
+}
@@ -0,0 +1,121 @@
+package mux
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	limiter := NewConcurrencyLimiter(ConcurrencyLimiterOptions{})
+	entered := make(chan struct{}, 2)
+	release := make(chan struct{})
+
+	router := NewRouter()
+	router.HandleFunc("/reports/{id}.pdf", func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+		w.Write([]byte("pdf"))
+	}).Name("pdf").Metadata(MetadataConcurrencyLimit, ConcurrencyLimit{MaxInFlight: 1, MaxQueue: 1})
+	router.HandleFunc("/free", stringHandler("free"))
+	router.Use(limiter.Middleware)
+
+	var wg sync.WaitGroup
+	codes := make([]int, 2)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rw := NewRecorder()
+			router.ServeHTTP(rw, newRequest("GET", "/reports/1.pdf"))
+			codes[i] = rw.Code
+		}(i)
+		if i == 0 {
+			<-entered
+		}
+	}
+	waitFor(t, func() bool {
+		s := limiter.Stats()
+		return len(s) == 1 && s[0].InFlight == 1 && s[0].Queued == 1
+	})
+
+	rw := NewRecorder()
+	router.ServeHTTP(rw, newRequest("GET", "/reports/2.pdf"))
+	if rw.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 when queue is full, got %d", rw.Code)
+	}
+	rw = NewRecorder()
+	router.ServeHTTP(rw, newRequest("GET", "/free"))
+	if rw.Code != http.StatusOK {
+		t.Errorf("Expected unlimited route to pass, got %d", rw.Code)
+	}
+
+	rw = NewRecorder()
+	limiter.Handler().ServeHTTP(rw, newRequest("GET", "/metrics"))
+	for _, want := range []string{
+		`http_concurrency_in_flight{group="pdf"} 1`,
+		`http_concurrency_queued{group="pdf"} 1`,
+		`http_concurrency_rejected_total{group="pdf"} 1`,
+	} {
+		if !strings.Contains(rw.Body.String(), want) {
+			t.Errorf("Expected %q in %q", want, rw.Body.String())
+		}
+	}
+
+	close(release)
+	wg.Wait()
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK {
+		t.Errorf("Expected queued request to be served, got %v", codes)
+	}
+}
+
+func TestConcurrencyLimiterQueueTimeout(t *testing.T) {
+	limiter := NewConcurrencyLimiter(ConcurrencyLimiterOptions{
+		Default: ConcurrencyLimit{Name: "all", MaxInFlight: 1, MaxQueue: 1, QueueTimeout: 10 * time.Millisecond},
+		RejectHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTooManyRequests)
+		}),
+	})
+	entered := make(chan struct{})
+	release := make(chan struct{})
+
+	router := NewRouter()
+	router.HandleFunc("/a", func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+	})
+	router.HandleFunc("/b", stringHandler("b"))
+	router.Use(limiter.Middleware)
+
+	done := make(chan struct{})
+	go func() {
+		router.ServeHTTP(NewRecorder(), newRequest("GET", "/a"))
+		close(done)
+	}()
+	<-entered
+
+	rw := NewRecorder()
+	router.ServeHTTP(rw, newRequest("GET", "/b"))
+	if rw.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected queue timeout to reject, got %d", rw.Code)
+	}
+	close(release)
+	<-done
+
+	if s := limiter.Stats(); len(s) != 1 || s[0].Name != "all" || s[0].Queued != 0 || s[0].InFlight != 0 {
+		t.Errorf("Unexpected stats %+v", s)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
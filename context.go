@@ -2,6 +2,7 @@ package mux
 
 import (
 	"context"
+	"net"
 	"net/http"
 )
 
@@ -10,9 +11,18 @@ type RouteMatch struct {
 	Route   *Route
 	Handler http.Handler
 	Vars    map[string]string
+	// VarsMulti 多值查询变量的所有值
+	VarsMulti map[string][]string
 
 	// MatchErr 设置为适当的匹配错误，如果存在不匹配，则设置为ErrMethodMismatch
 	MatchErr error
+
+	// rewrite RewritePath 开启时改写后的规范路径，ServeHTTP 会把它传给处理器
+	rewrite string
+	// redirect 为 true 时路由已经设置了重定向到规范路径的处理器
+	redirect bool
+	// method 子路由器的 MethodOverride 覆盖后的方法，ServeHTTP 会把它传给处理器
+	method string
 }
 
 type contextKey int
@@ -20,6 +30,12 @@ type contextKey int
 const (
 	varsKey contextKey = iota
 	routeKey
+	varsMultiKey
+	forwardedKey
+	matchRecordKey
+	spanKey
+	requestIDKey
+	principalKey
 )
 
 // Vars 返回当前请求的路由变量(如果有)
@@ -30,6 +46,36 @@ func Vars(r *http.Request) map[string]string {
 	return nil
 }
 
+// VarsMulti 返回当前请求的多值查询变量(如果有)，如 Queries("tag", "{tags[]}")
+func VarsMulti(r *http.Request) map[string][]string {
+	if rv := r.Context().Value(varsMultiKey); rv != nil {
+		return rv.(map[string][]string)
+	}
+	return nil
+}
+
+// Principal 认证后的主体，由认证中间件通过 WithPrincipal 放入请求上下文
+// 如 auth 子包中的 *auth.Principal
+type Principal interface {
+	// Subject 返回主体的标识
+	Subject() string
+	// HasScope 如果主体拥有给定的权限范围，则返回true
+	HasScope(scope string) bool
+	// HasRole 如果主体拥有给定的角色，则返回true
+	HasRole(role string) bool
+}
+
+// WithPrincipal 返回保存了主体的上下文
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+// PrincipalFromContext 返回上下文中的主体，没有时返回nil
+func PrincipalFromContext(ctx context.Context) Principal {
+	p, _ := ctx.Value(principalKey).(Principal)
+	return p
+}
+
 // CurrentRoute 返回当前请求匹配的路由(如果有)
 func CurrentRoute(r *http.Request) *Route {
 	if rv := r.Context().Value(routeKey); rv != nil {
@@ -47,3 +93,51 @@ func requestWithRoute(r *http.Request, route *Route) *http.Request {
 	ctx := context.WithValue(r.Context(), routeKey, route)
 	return r.WithContext(ctx)
 }
+
+func requestWithVarsMulti(r *http.Request, vars map[string][]string) *http.Request {
+	ctx := context.WithValue(r.Context(), varsMultiKey, vars)
+	return r.WithContext(ctx)
+}
+
+// matchRecord 记录 ServeHTTP 的匹配结果
+// 通过 UsePreMatch 包裹路由的中间件无法从自己的请求中获取 CurrentRoute，可以在处理完成后读取它
+type matchRecord struct {
+	route *Route
+	vars  map[string]string
+	err   error
+	// ip 路由器按信任的代理解析出的客户端地址
+	ip net.IP
+}
+
+// withMatchRecord 返回带有匹配记录的请求，请求中已有记录时复用
+func withMatchRecord(r *http.Request) (*http.Request, *matchRecord) {
+	if rec, ok := r.Context().Value(matchRecordKey).(*matchRecord); ok {
+		return r, rec
+	}
+	rec := &matchRecord{}
+	ctx := context.WithValue(r.Context(), matchRecordKey, rec)
+	return r.WithContext(ctx), rec
+}
+
+// matched 返回请求匹配的路由和变量，优先使用请求中的 CurrentRoute
+func (rec *matchRecord) matched(r *http.Request) (*Route, map[string]string) {
+	if route := CurrentRoute(r); route != nil {
+		return route, Vars(r)
+	}
+	return rec.route, rec.vars
+}
+
+// clientIP 返回请求的客户端地址，优先使用路由器记录的地址
+func (rec *matchRecord) clientIP(r *http.Request) net.IP {
+	if rec.ip != nil {
+		return rec.ip
+	}
+	return ClientIP(r)
+}
+
+func recordMatch(r *http.Request, match *RouteMatch) {
+	if rec, ok := r.Context().Value(matchRecordKey).(*matchRecord); ok {
+		rec.route, rec.vars, rec.err = match.Route, match.Vars, match.MatchErr
+		rec.ip = ClientIP(r)
+	}
+}
@@ -0,0 +1,274 @@
+package mux
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// MetadataNoETag 路由元数据中关闭 ETag 的键，值为 true 时 ETag 中间件不处理该路由
+	MetadataNoETag = "mux.noetag"
+	// MetadataETagFunc 路由元数据中 ETag 函数的键，值为 ETagFunc
+	MetadataETagFunc = "mux.etagfunc"
+)
+
+// defaultETagMaxSize 默认缓冲的最大响应大小
+const defaultETagMaxSize = 1 << 20
+
+// ETagFunc 不运行处理器直接计算资源当前的 ETag，可以通过 mux.Vars 读取路由变量
+// 返回空字符串表示资源不存在或无法计算，没有引号的值会被当作强 ETag
+//
+//	r.HandleFunc("/articles/{id}", ArticleHandler).
+//	  Metadata(mux.MetadataETagFunc, mux.ETagFunc(func(r *http.Request) string {
+//	    return articleVersion(mux.Vars(r)["id"])
+//	  }))
+type ETagFunc func(r *http.Request) string
+
+// ETagOptions 配置 ETag 中间件
+type ETagOptions struct {
+	// MaxSize 缓冲的最大响应大小，超出时不再计算 ETag，默认为1MB
+	MaxSize int
+	// Weak 如果为 true，计算的 ETag 是弱 ETag
+	Weak bool
+}
+
+// ETag 返回处理条件请求的中间件，应该通过 Router.Use 注册
+// GET 和 HEAD 请求的200响应会被缓冲并计算 ETag，处理器设置了 ETag 时使用处理器的值，
+// 然后根据 If-Match、If-Unmodified-Since、If-None-Match 和 If-Modified-Since 返回304或412
+// 路由在元数据中设置了 ETagFunc 时不缓冲响应，条件不满足时不会运行处理器
+func ETag(opts ETagOptions) MiddlewareFunc {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = defaultETagMaxSize
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			var etagFunc ETagFunc
+			if route := CurrentRoute(req); route != nil {
+				if off, _ := route.GetMetadataValueOr(MetadataNoETag, false).(bool); off {
+					next.ServeHTTP(w, req)
+					return
+				}
+				switch f := route.GetMetadataValueOr(MetadataETagFunc, nil).(type) {
+				case ETagFunc:
+					etagFunc = f
+				case func(*http.Request) string:
+					etagFunc = f
+				}
+			}
+			if etagFunc != nil {
+				// 资源不存在时 If-Match 仍然失败，If-None-Match: * 仍然满足
+				etag := quoteETag(etagFunc(req))
+				if etag != "" {
+					w.Header().Set("ETag", etag)
+				}
+				if code := checkPreconditions(req, etag, time.Time{}); code != 0 {
+					writeConditional(w, code)
+					return
+				}
+				next.ServeHTTP(w, req)
+				return
+			}
+			if req.Method != http.MethodGet && req.Method != http.MethodHead {
+				next.ServeHTTP(w, req)
+				return
+			}
+			ew := &etagWriter{ResponseWriter: w, maxSize: opts.MaxSize}
+			next.ServeHTTP(ew, req)
+			ew.finish(req, opts.Weak)
+		})
+	}
+}
+
+// quoteETag 为没有引号的值加上引号
+func quoteETag(etag string) string {
+	if etag == "" || strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, `W/"`) {
+		return etag
+	}
+	return `"` + etag + `"`
+}
+
+// checkPreconditions 按 RFC 9110 13.2.2 的顺序检查条件请求头
+// 返回 304 或 412，条件满足时返回0
+func checkPreconditions(req *http.Request, etag string, lastModified time.Time) int {
+	if im := req.Header.Get("If-Match"); im != "" {
+		if !etagMatch(im, etag, false) {
+			return http.StatusPreconditionFailed
+		}
+	} else if ius := req.Header.Get("If-Unmodified-Since"); ius != "" && !lastModified.IsZero() {
+		if t, err := http.ParseTime(ius); err == nil && lastModified.Truncate(time.Second).After(t) {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	safe := req.Method == http.MethodGet || req.Method == http.MethodHead
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		if etagMatch(inm, etag, true) {
+			if safe {
+				return http.StatusNotModified
+			}
+			return http.StatusPreconditionFailed
+		}
+	} else if ims := req.Header.Get("If-Modified-Since"); ims != "" && safe && !lastModified.IsZero() {
+		if t, err := http.ParseTime(ims); err == nil && !lastModified.Truncate(time.Second).After(t) {
+			return http.StatusNotModified
+		}
+	}
+	return 0
+}
+
+// etagMatch 如果条件请求头中的 ETag 列表包含 etag，则返回true，weak 为 true 时使用弱比较
+func etagMatch(header, etag string, weak bool) bool {
+	if etag == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	opaque, isWeak := strings.CutPrefix(etag, "W/")
+	if isWeak && !weak {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		c, cWeak := strings.CutPrefix(candidate, "W/")
+		if cWeak && !weak {
+			continue
+		}
+		if c == opaque {
+			return true
+		}
+	}
+	return false
+}
+
+// writeConditional 写出304或412响应，304只保留与缓存相关的响应头
+func writeConditional(w http.ResponseWriter, code int) {
+	h := w.Header()
+	if code == http.StatusNotModified {
+		for _, key := range []string{"Content-Type", "Content-Length", "Content-Encoding", "Transfer-Encoding"} {
+			h.Del(key)
+		}
+		w.WriteHeader(code)
+		return
+	}
+	http.Error(w, http.StatusText(code), code)
+}
+
+// etagWriter 缓冲不超过 maxSize 的响应，超出、Flush 或 Hijack 时直接写出
+type etagWriter struct {
+	http.ResponseWriter
+	maxSize     int
+	code        int
+	buf         []byte
+	passthrough bool
+}
+
+func (w *etagWriter) WriteHeader(code int) {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+func (w *etagWriter) Write(b []byte) (int, error) {
+	if w.passthrough {
+		return w.ResponseWriter.Write(b)
+	}
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	if w.code != http.StatusOK || len(w.buf)+len(b) > w.maxSize {
+		if err := w.bypass(); err != nil {
+			return 0, err
+		}
+		return w.ResponseWriter.Write(b)
+	}
+	w.buf = append(w.buf, b...)
+	return len(b), nil
+}
+
+// bypass 放弃计算 ETag，写出已缓冲的响应
+func (w *etagWriter) bypass() error {
+	w.passthrough = true
+	if w.code == 0 {
+		return nil
+	}
+	w.ResponseWriter.WriteHeader(w.code)
+	if len(w.buf) == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(w.buf)
+	w.buf = nil
+	return err
+}
+
+// finish 计算 ETag，检查条件请求头并写出响应
+func (w *etagWriter) finish(req *http.Request, weak bool) {
+	if w.passthrough || w.code == 0 {
+		return
+	}
+	h := w.Header()
+	etag := h.Get("ETag")
+	if w.code == http.StatusOK && etag == "" && (len(w.buf) > 0 || req.Method == http.MethodGet) {
+		sum := sha256.Sum256(w.buf)
+		etag = `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+		if weak {
+			etag = "W/" + etag
+		}
+		h.Set("ETag", etag)
+	}
+	if w.code == http.StatusOK {
+		var lastModified time.Time
+		if lm := h.Get("Last-Modified"); lm != "" {
+			lastModified, _ = http.ParseTime(lm)
+		}
+		if code := checkPreconditions(req, etag, lastModified); code != 0 {
+			w.buf = nil
+			writeConditional(w.ResponseWriter, code)
+			return
+		}
+	}
+	w.bypass()
+}
+
+func (w *etagWriter) Flush() {
+	if !w.passthrough {
+		if w.code == 0 {
+			w.code = http.StatusOK
+		}
+		w.bypass()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *etagWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("mux: response writer does not support hijacking")
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		w.passthrough = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap 返回被包裹的 ResponseWriter，供 http.ResponseController 使用
+func (w *etagWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
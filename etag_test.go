@@ -0,0 +1,129 @@
+package mux
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestETag(t *testing.T) {
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	router := NewRouter()
+	router.HandleFunc("/doc", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+		io.WriteString(w, "document")
+	})
+	router.HandleFunc("/big", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, strings.Repeat("x", 20))
+	})
+	router.HandleFunc("/off", stringHandler("off")).Metadata(MetadataNoETag, true)
+	router.Use(ETag(ETagOptions{MaxSize: 10}))
+
+	rw := NewRecorder()
+	router.ServeHTTP(rw, newRequest("GET", "/doc"))
+	etag := rw.HeaderMap.Get("ETag")
+	if rw.Code != http.StatusOK || rw.Body.String() != "document" || !strings.HasPrefix(etag, `"`) {
+		t.Fatalf("Unexpected response %d %q %q", rw.Code, rw.Body.String(), etag)
+	}
+
+	before := modified.Add(-time.Hour).Format(http.TimeFormat)
+	after := modified.Add(time.Hour).Format(http.TimeFormat)
+	tests := []struct {
+		method  string
+		headers []string
+		expCode int
+	}{
+		{"GET", []string{"If-None-Match", etag}, http.StatusNotModified},
+		{"GET", []string{"If-None-Match", `"other", W/` + etag}, http.StatusNotModified},
+		{"HEAD", []string{"If-None-Match", "*"}, http.StatusNotModified},
+		{"GET", []string{"If-None-Match", `"other"`}, http.StatusOK},
+		{"GET", []string{"If-None-Match", `"other"`, "If-Modified-Since", after}, http.StatusOK},
+		{"GET", []string{"If-Modified-Since", after}, http.StatusNotModified},
+		{"GET", []string{"If-Modified-Since", before}, http.StatusOK},
+		{"GET", []string{"If-Match", etag}, http.StatusOK},
+		{"GET", []string{"If-Match", "W/" + etag}, http.StatusPreconditionFailed},
+		{"GET", []string{"If-Match", `"other"`}, http.StatusPreconditionFailed},
+		{"GET", []string{"If-Unmodified-Since", before}, http.StatusPreconditionFailed},
+		{"GET", []string{"If-Unmodified-Since", after}, http.StatusOK},
+	}
+	for _, test := range tests {
+		rw := NewRecorder()
+		router.ServeHTTP(rw, newRequestWithHeaders(test.method, "/doc", test.headers...))
+		if rw.Code != test.expCode {
+			t.Errorf("%s %v: expected %d, got %d", test.method, test.headers, test.expCode, rw.Code)
+		}
+		if rw.Code == http.StatusNotModified && (rw.Body.Len() != 0 || rw.HeaderMap.Get("ETag") != etag) {
+			t.Errorf("%s %v: unexpected 304 response %q %v", test.method, test.headers, rw.Body.String(), rw.HeaderMap)
+		}
+	}
+
+	rw = NewRecorder()
+	router.ServeHTTP(rw, newRequest("GET", "/big"))
+	if rw.HeaderMap.Get("ETag") != "" || rw.Body.Len() != 20 {
+		t.Errorf("Expected large response to pass through, got %v %d", rw.HeaderMap, rw.Body.Len())
+	}
+	rw = NewRecorder()
+	router.ServeHTTP(rw, newRequest("GET", "/off"))
+	if rw.HeaderMap.Get("ETag") != "" || rw.Body.String() != "off" {
+		t.Errorf("Expected opted-out route to pass through, got %v", rw.HeaderMap)
+	}
+}
+
+func TestETagWeak(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc("/", stringHandler("home"))
+	router.Use(ETag(ETagOptions{Weak: true}))
+
+	rw := NewRecorder()
+	router.ServeHTTP(rw, newRequest("GET", "/"))
+	etag := rw.HeaderMap.Get("ETag")
+	if !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("Expected weak ETag, got %q", etag)
+	}
+	rw = NewRecorder()
+	router.ServeHTTP(rw, newRequestWithHeaders("GET", "/", "If-None-Match", strings.TrimPrefix(etag, "W/")))
+	if rw.Code != http.StatusNotModified {
+		t.Errorf("Expected weak comparison to match, got %d", rw.Code)
+	}
+}
+
+func TestETagFunc(t *testing.T) {
+	calls := 0
+	versions := map[string]string{"1": "v7"}
+	router := NewRouter()
+	router.HandleFunc("/articles/{id}", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		io.WriteString(w, "article")
+	}).Metadata(MetadataETagFunc, ETagFunc(func(r *http.Request) string {
+		return versions[Vars(r)["id"]]
+	}))
+	router.Use(ETag(ETagOptions{}))
+
+	tests := []struct {
+		method   string
+		path     string
+		headers  []string
+		expCode  int
+		expCalls int
+	}{
+		{"GET", "/articles/1", []string{"If-None-Match", `"v7"`}, http.StatusNotModified, 0},
+		{"GET", "/articles/1", []string{"If-None-Match", `"v6"`}, http.StatusOK, 1},
+		{"PUT", "/articles/1", []string{"If-Match", `"v6"`}, http.StatusPreconditionFailed, 1},
+		{"PUT", "/articles/1", []string{"If-Match", `"v7"`}, http.StatusOK, 2},
+		{"PUT", "/articles/1", []string{"If-None-Match", "*"}, http.StatusPreconditionFailed, 2},
+		{"GET", "/articles/2", []string{"If-None-Match", "*"}, http.StatusOK, 3},
+		{"PUT", "/articles/2", []string{"If-Match", "*"}, http.StatusPreconditionFailed, 3},
+		{"PUT", "/articles/2", []string{"If-Match", `"v7"`}, http.StatusPreconditionFailed, 3},
+		{"PUT", "/articles/2", []string{"If-None-Match", "*"}, http.StatusOK, 4},
+	}
+	for _, test := range tests {
+		rw := NewRecorder()
+		router.ServeHTTP(rw, newRequestWithHeaders(test.method, test.path, test.headers...))
+		if rw.Code != test.expCode || calls != test.expCalls {
+			t.Errorf("%s %s %v: expected %d with %d calls, got %d with %d calls",
+				test.method, test.path, test.headers, test.expCode, test.expCalls, rw.Code, calls)
+		}
+	}
+}
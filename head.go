@@ -0,0 +1,66 @@
+package mux
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// headHandler 用 GET 处理器响应 HEAD 请求，丢弃响应体
+func headHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		hw := &headResponseWriter{ResponseWriter: w}
+		h.ServeHTTP(hw, req)
+		hw.commit()
+	})
+}
+
+// headResponseWriter 丢弃写入的响应体，只记录长度
+// 状态码会延迟到处理器返回时再写出，以便补上 Content-Length
+type headResponseWriter struct {
+	http.ResponseWriter
+	status    int
+	written   int64
+	committed bool
+}
+
+func (w *headResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *headResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.written += int64(len(b))
+	return len(b), nil
+}
+
+// Flush 提前写出响应头，此时已无法补上 Content-Length
+func (w *headResponseWriter) Flush() {
+	w.commit()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *headResponseWriter) commit() {
+	if w.committed {
+		return
+	}
+	w.committed = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	h := w.ResponseWriter.Header()
+	if w.written > 0 && h.Get("Content-Length") == "" {
+		h.Set("Content-Length", strconv.FormatInt(w.written, 10))
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+// Unwrap 返回被包裹的 ResponseWriter，供 http.ResponseController 使用
+func (w *headResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
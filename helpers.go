@@ -1,10 +1,15 @@
 package mux
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
 	"path"
 	"regexp"
+	"strings"
 )
 
 // cleanPath 清理url路径，从net/http包中借用
@@ -23,6 +28,30 @@ func cleanPath(p string) string {
 	return np
 }
 
+// requestWithMethod 返回一个只替换了方法的请求浅拷贝，用于匹配
+func requestWithMethod(r *http.Request, method string) *http.Request {
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.Method = method
+	return r2
+}
+
+// requestWithPath 返回一个替换了路径的请求浅拷贝，encoded 表示 p 是经过编码的路径
+func requestWithPath(r *http.Request, p string, encoded bool) *http.Request {
+	r2 := new(http.Request)
+	*r2 = *r
+	u := *r.URL
+	if encoded {
+		if unescaped, err := url.PathUnescape(p); err == nil {
+			u.Path, u.RawPath = unescaped, p
+		}
+	} else {
+		u.Path, u.RawPath = p, ""
+	}
+	r2.URL = &u
+	return r2
+}
+
 // uniqueVars 如果两个切片包含重复的字符串，则返回错误
 func uniqueVars(s1, s2 []string) error {
 	for _, v1 := range s1 {
@@ -58,6 +87,15 @@ func mapFromPairsToString(pairs ...string) (map[string]string, error) {
 	return m, nil
 }
 
+// mapFromPairsToMulti 将可变的字符串参数转换为字符串到字符串切片的映射，保留重复的键
+func mapFromPairsToMulti(pairs ...string) map[string][]string {
+	m := make(map[string][]string, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		m[pairs[i]] = append(m[pairs[i]], pairs[i+1])
+	}
+	return m
+}
+
 // mapFromPairsToRegex 将可变的字符串参数转换为字符串到正则表达式映射
 func mapFromPairsToRegex(pairs ...string) (map[string]*regexp.Regexp, error) {
 	length, err := checkPairs(pairs...)
@@ -137,6 +175,11 @@ func matchMapWithRegex(toCheck map[string]*regexp.Regexp, toMatch map[string][]s
 	return true
 }
 
+// unknownQuery 使用HTTP状态码400响应请求，并列出未知的查询参数
+func unknownQuery(w http.ResponseWriter, r *http.Request, unknown []string) {
+	http.Error(w, "unknown query parameters: "+strings.Join(unknown, ", "), http.StatusBadRequest)
+}
+
 // methodNotAllowed 使用HTTP状态码405响应请求
 func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusMethodNotAllowed)
@@ -144,3 +187,46 @@ func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
 
 // methodNotAllowedHandler 返回一个简单的请求处理程序，用状态码405响应每个请求
 func methodNotAllowedHandler() http.Handler { return http.HandlerFunc(methodNotAllowed) }
+
+// routeLabel 返回用于标识路由的名称，未命名时使用路径模板
+func routeLabel(route *Route) string {
+	if route == nil {
+		return ""
+	}
+	if name := route.GetName(); name != "" {
+		return name
+	}
+	tpl, _ := route.GetPathTemplate()
+	return tpl
+}
+
+// overrideBody 在读取覆盖方法的表单字段后还原请求体，并缓存读取结果，避免重复读取
+type overrideBody struct {
+	io.Reader
+	io.Closer
+	method string
+}
+
+// overrideFormValue 从 urlencoded 请求体中读取覆盖方法的表单字段
+// 最多读取 methodOverrideMaxBody 字节，读取的内容会放回请求体，处理器仍能完整读取
+func overrideFormValue(req *http.Request) string {
+	if body, ok := req.Body.(*overrideBody); ok {
+		return body.method
+	}
+	if req.Body == nil || req.Body == http.NoBody || req.ContentLength > methodOverrideMaxBody {
+		return ""
+	}
+	ct, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil || ct != "application/x-www-form-urlencoded" {
+		return ""
+	}
+	buf, err := io.ReadAll(io.LimitReader(req.Body, methodOverrideMaxBody+1))
+	body := &overrideBody{Reader: io.MultiReader(bytes.NewReader(buf), req.Body), Closer: req.Body}
+	if err == nil && len(buf) <= methodOverrideMaxBody {
+		if values, err := url.ParseQuery(string(buf)); err == nil {
+			body.method = values.Get(methodOverrideField)
+		}
+	}
+	req.Body = body
+	return body.method
+}
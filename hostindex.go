@@ -0,0 +1,86 @@
+package mux
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// hostIndexThreshold 可索引的主机路由达到此数量时才使用主机索引
+const hostIndexThreshold = 16
+
+// hostIndex 按主机索引路由器的路由，避免逐个尝试主机正则表达式
+// 索引在第一次匹配时建立，路由数量变化时重建，开始处理请求后不应再修改已有路由的主机
+type hostIndex struct {
+	// 建立索引时的路由数量
+	routes int
+	// 主机模板没有变量的路由
+	exact map[string][]int
+	// 主机模板以 ".example.com" 这样的字面量结尾的路由
+	suffix map[string][]int
+	// 无法索引的路由，总是需要尝试
+	always []int
+	// 已索引的路由数量
+	indexed int
+}
+
+// newHostIndex 为给定的路由建立主机索引
+func newHostIndex(routes []*Route) *hostIndex {
+	idx := &hostIndex{
+		routes: len(routes),
+		exact:  make(map[string][]int),
+		suffix: make(map[string][]int),
+	}
+	for i, route := range routes {
+		h := route.regexp.host
+		if h == nil || !h.wildcardHostPort {
+			idx.always = append(idx.always, i)
+			continue
+		}
+		if len(h.varsN) == 0 {
+			idx.exact[h.literals[0]] = append(idx.exact[h.literals[0]], i)
+			idx.indexed++
+			continue
+		}
+		// 主机必须以最后一个字面量结尾
+		if last := h.literals[len(h.literals)-1]; strings.HasPrefix(last, ".") && len(last) > 1 {
+			idx.suffix[last] = append(idx.suffix[last], i)
+			idx.indexed++
+			continue
+		}
+		idx.always = append(idx.always, i)
+	}
+	return idx
+}
+
+// candidates 按注册顺序返回可能匹配请求主机的路由
+func (idx *hostIndex) candidates(req *http.Request, routes []*Route) []*Route {
+	host, _ := splitHostPort(getHost(req))
+	found := make([]int, 0, len(idx.always)+4)
+	found = append(found, idx.always...)
+	found = append(found, idx.exact[host]...)
+	for i := 0; i < len(host); i++ {
+		if host[i] == '.' {
+			found = append(found, idx.suffix[host[i:]]...)
+		}
+	}
+	sort.Ints(found)
+	candidates := make([]*Route, len(found))
+	for i, k := range found {
+		candidates[i] = routes[k]
+	}
+	return candidates
+}
+
+// matchRoutes 返回需要按顺序尝试的路由，路由足够多时通过主机索引过滤
+func (r *Router) matchRoutes(req *http.Request) []*Route {
+	idx := r.hostIdx.Load()
+	if idx == nil || idx.routes != len(r.routes) {
+		idx = newHostIndex(r.routes)
+		r.hostIdx.Store(idx)
+	}
+	if idx.indexed < hostIndexThreshold {
+		return r.routes
+	}
+	return idx.candidates(req, r.routes)
+}
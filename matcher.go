@@ -35,13 +35,5 @@ func (m methodMatcher) Match(r *http.Request, match *RouteMatch) bool {
 type schemeMatcher []string
 
 func (m schemeMatcher) Match(r *http.Request, match *RouteMatch) bool {
-	scheme := r.URL.Scheme
-	if scheme == "" {
-		if r.TLS == nil {
-			scheme = "http"
-		} else {
-			scheme = "https"
-		}
-	}
-	return matchInArray(m, scheme)
+	return matchInArray(m, requestScheme(r))
 }
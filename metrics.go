@@ -0,0 +1,237 @@
+package mux
+
+import (
+	"bufio"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 未匹配路由的请求使用的固定标签，避免随机 URL 导致标签数量失控
+const (
+	metricsNotFound         = "not_found"
+	metricsMethodNotAllowed = "method_not_allowed"
+)
+
+// DefaultLatencyBuckets 默认的延迟直方图分桶，单位为秒
+var DefaultLatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultSizeBuckets 默认的响应大小直方图分桶，单位为字节
+var DefaultSizeBuckets = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
+
+// MetricsOptions 配置 Metrics
+type MetricsOptions struct {
+	// Namespace 指标名称的前缀，默认为 "http"
+	Namespace string
+	// LatencyBuckets 延迟直方图的分桶，默认为 DefaultLatencyBuckets
+	LatencyBuckets []float64
+	// SizeBuckets 响应大小直方图的分桶，默认为 DefaultSizeBuckets
+	SizeBuckets []float64
+}
+
+// Metrics 收集请求数、延迟、并发请求数和响应大小，
+// 以路由名称（未命名时使用路径模板）、方法和状态码类别作为标签
+type Metrics struct {
+	namespace      string
+	latencyBuckets []float64
+	sizeBuckets    []float64
+	inFlight       atomic.Int64
+
+	mu     sync.Mutex
+	series map[metricsLabels]*metricsSeries
+}
+
+type metricsLabels struct {
+	route, method, status string
+}
+
+type metricsSeries struct {
+	count   uint64
+	latency histogram
+	size    histogram
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+}
+
+func (h *histogram) observe(buckets []float64, v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(buckets))
+	}
+	for i, b := range buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+}
+
+// NewMetrics 创建 Metrics
+func NewMetrics(opts MetricsOptions) *Metrics {
+	m := &Metrics{
+		namespace:      opts.Namespace,
+		latencyBuckets: opts.LatencyBuckets,
+		sizeBuckets:    opts.SizeBuckets,
+		series:         make(map[metricsLabels]*metricsSeries),
+	}
+	if m.namespace == "" {
+		m.namespace = "http"
+	}
+	if m.latencyBuckets == nil {
+		m.latencyBuckets = DefaultLatencyBuckets
+	}
+	if m.sizeBuckets == nil {
+		m.sizeBuckets = DefaultSizeBuckets
+	}
+	return m
+}
+
+// Middleware 收集指标的中间件，通过 UsePreMatch 注册时也会统计 404 和 405
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		m.inFlight.Add(1)
+		defer m.inFlight.Add(-1)
+
+		start := time.Now()
+		req, rec := withMatchRecord(req)
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, req)
+
+		labels := metricsLabels{
+			method: metricsMethod(req.Method),
+			status: strconv.Itoa(sw.Status()/100) + "xx",
+		}
+		if route, _ := rec.matched(req); route != nil {
+			labels.route = routeLabel(route)
+		} else if rec.err == ErrMethodMismatch {
+			labels.route = metricsMethodNotAllowed
+		} else {
+			labels.route = metricsNotFound
+		}
+		m.observe(labels, time.Since(start).Seconds(), float64(sw.written))
+	})
+}
+
+func (m *Metrics) observe(labels metricsLabels, latency, size float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.series[labels]
+	if s == nil {
+		s = &metricsSeries{}
+		m.series[labels] = s
+	}
+	s.count++
+	s.latency.observe(m.latencyBuckets, latency)
+	s.size.observe(m.sizeBuckets, size)
+}
+
+// Handler 返回以文本格式输出指标的 Handler，格式与 Prometheus 兼容
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		m.writeTo(bw)
+		bw.Flush()
+	})
+}
+
+func (m *Metrics) writeTo(w *bufio.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]metricsLabels, 0, len(m.series))
+	for k := range m.series {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+
+	name := m.namespace + "_requests_total"
+	writeMetricHeader(w, name, "counter", "Total number of HTTP requests.")
+	for _, k := range keys {
+		w.WriteString(name + k.format("") + " " + strconv.FormatUint(m.series[k].count, 10) + "\n")
+	}
+
+	name = m.namespace + "_request_duration_seconds"
+	writeMetricHeader(w, name, "histogram", "HTTP request latency in seconds.")
+	for _, k := range keys {
+		s := m.series[k]
+		writeHistogram(w, name, k, m.latencyBuckets, &s.latency, s.count)
+	}
+
+	name = m.namespace + "_response_size_bytes"
+	writeMetricHeader(w, name, "histogram", "HTTP response size in bytes.")
+	for _, k := range keys {
+		s := m.series[k]
+		writeHistogram(w, name, k, m.sizeBuckets, &s.size, s.count)
+	}
+
+	name = m.namespace + "_requests_in_flight"
+	writeMetricHeader(w, name, "gauge", "Number of HTTP requests currently being served.")
+	w.WriteString(name + " " + strconv.FormatInt(m.inFlight.Load(), 10) + "\n")
+}
+
+func writeMetricHeader(w *bufio.Writer, name, typ, help string) {
+	w.WriteString("# HELP " + name + " " + help + "\n")
+	w.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+func writeHistogram(w *bufio.Writer, name string, k metricsLabels, buckets []float64, h *histogram, count uint64) {
+	for i, b := range buckets {
+		var n uint64
+		if h.counts != nil {
+			n = h.counts[i]
+		}
+		w.WriteString(name + "_bucket" + k.format(formatFloat(b)) + " " + strconv.FormatUint(n, 10) + "\n")
+	}
+	w.WriteString(name + "_bucket" + k.format("+Inf") + " " + strconv.FormatUint(count, 10) + "\n")
+	w.WriteString(name + "_sum" + k.format("") + " " + formatFloat(h.sum) + "\n")
+	w.WriteString(name + "_count" + k.format("") + " " + strconv.FormatUint(count, 10) + "\n")
+}
+
+// format 返回标签集合的文本形式，le 不为空时追加 le 标签
+func (k metricsLabels) format(le string) string {
+	var b strings.Builder
+	b.WriteString(`{route="` + escapeLabel(k.route))
+	b.WriteString(`",method="` + escapeLabel(k.method))
+	b.WriteString(`",status="` + k.status + `"`)
+	if le != "" {
+		b.WriteString(`,le="` + le + `"`)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// metricsMethod 非标准方法统一记为 OTHER
+func metricsMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
@@ -0,0 +1,48 @@
+package mux
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics(MetricsOptions{LatencyBuckets: []float64{1}, SizeBuckets: []float64{3}})
+	router := NewRouter()
+	router.HandleFunc("/orders/{id}", stringHandler("order")).Methods("GET")
+	router.HandleFunc("/users/{id}", stringHandler("ab")).Name("user")
+	router.UsePreMatch(m.Middleware)
+
+	for _, req := range []*http.Request{
+		newRequest("GET", "/orders/1"),
+		newRequest("GET", "/orders/2"),
+		newRequest("BREW", "/users/1"),
+		newRequest("POST", "/orders/1"),
+		newRequest("GET", "/random/1"),
+		newRequest("GET", "/random/2"),
+	} {
+		router.ServeHTTP(NewRecorder(), req)
+	}
+
+	rw := NewRecorder()
+	m.Handler().ServeHTTP(rw, newRequest("GET", "/metrics"))
+	out := rw.Body.String()
+
+	for _, want := range []string{
+		`http_requests_total{route="/orders/{id}",method="GET",status="2xx"} 2`,
+		`http_requests_total{route="user",method="OTHER",status="2xx"} 1`,
+		`http_requests_total{route="method_not_allowed",method="POST",status="4xx"} 1`,
+		`http_requests_total{route="not_found",method="GET",status="4xx"} 2`,
+		`http_request_duration_seconds_bucket{route="/orders/{id}",method="GET",status="2xx",le="+Inf"} 2`,
+		`http_request_duration_seconds_count{route="/orders/{id}",method="GET",status="2xx"} 2`,
+		`http_response_size_bytes_bucket{route="user",method="OTHER",status="2xx",le="3"} 1`,
+		`http_response_size_bytes_bucket{route="/orders/{id}",method="GET",status="2xx",le="3"} 0`,
+		`http_response_size_bytes_sum{route="/orders/{id}",method="GET",status="2xx"} 10`,
+		"# TYPE http_request_duration_seconds histogram",
+		"http_requests_in_flight 0",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in output:\n%s", want, out)
+		}
+	}
+}
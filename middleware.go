@@ -25,6 +25,15 @@ func (r *Router) useInterface(mw middleware) {
 	r.middlewares = append(r.middlewares, mw)
 }
 
+// UsePreMatch 添加在路由匹配之前执行的中间件
+// 它们包裹整个 ServeHTTP，包括路径清理、404 和 405，可以在匹配前修改请求
+// 子路由器通过 Match 参与匹配，不会执行自己的 UsePreMatch 中间件
+func (r *Router) UsePreMatch(mwf ...MiddlewareFunc) {
+	for _, fn := range mwf {
+		r.preMatchMiddlewares = append(r.preMatchMiddlewares, fn)
+	}
+}
+
 // CORSMethodMiddleware 自动设置Access-Control-Allow-Methods响应头
 func CORSMethodMiddleware(r *Router) MiddlewareFunc {
 	return func(next http.Handler) http.Handler {
@@ -562,3 +562,48 @@ func TestMiddlewareOnMultiSubrouter(t *testing.T) {
 		}
 	})
 }
+
+func TestMiddlewarePreMatch(t *testing.T) {
+	mwStr := []byte("PreMatch\n")
+	handlerStr := []byte("Logic\n")
+
+	router := NewRouter()
+	router.HandleFunc("/", func(w http.ResponseWriter, e *http.Request) {
+		w.Write(handlerStr)
+	}).Methods("GET")
+	router.HandleFunc("/rewritten", func(w http.ResponseWriter, e *http.Request) {
+		w.Write(handlerStr)
+	})
+	router.UsePreMatch(func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(mwStr)
+			if r.URL.Path == "/legacy" {
+				r.URL.Path = "/rewritten"
+			}
+			h.ServeHTTP(w, r)
+		})
+	})
+
+	tests := []struct {
+		title   string
+		method  string
+		path    string
+		expBody []byte
+	}{
+		{title: "called for match", method: "GET", path: "/", expBody: append(mwStr, handlerStr...)},
+		{title: "called for 404", method: "GET", path: "/notfound", expBody: mwStr},
+		{title: "called for 405", method: "POST", path: "/", expBody: mwStr},
+		{title: "called for clean path redirect", method: "GET", path: "//", expBody: mwStr},
+		{title: "can rewrite request before matching", method: "GET", path: "/legacy", expBody: append(mwStr, handlerStr...)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			rw := NewRecorder()
+			router.ServeHTTP(rw, newRequest(test.method, test.path))
+			if !bytes.HasPrefix(rw.Body.Bytes(), test.expBody) {
+				t.Fatalf("Expected body to start with %q, got %q", test.expBody, rw.Body.String())
+			}
+		})
+	}
+}
@@ -2,7 +2,12 @@ package mux
 
 import (
 	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 var (
@@ -10,6 +15,17 @@ var (
 	ErrMethodMismatch = errors.New("method is not allowed")
 	// ErrNotFound 当没有找到匹配的路由时返回
 	ErrNotFound = errors.New("no matching route was found")
+	// ErrMetadataKeyNotFound 当路由没有给定键的元数据时返回
+	ErrMetadataKeyNotFound = errors.New("key not found in metadata")
+)
+
+const (
+	// methodOverrideHeader 用于覆盖请求方法的请求头
+	methodOverrideHeader = "X-HTTP-Method-Override"
+	// methodOverrideField 用于覆盖请求方法的表单字段
+	methodOverrideField = "_method"
+	// methodOverrideMaxBody 查找覆盖方法的表单字段时最多读取的请求体字节数
+	methodOverrideMaxBody = 8 << 10
 )
 
 // NewRouter 创建一个路由器实例
@@ -29,27 +45,81 @@ type Router struct {
 	namedRoutes map[string]*Route
 	// 中间件
 	middlewares []middleware
+	// 路由匹配之前执行的中间件
+	preMatchMiddlewares []middleware
+	// 允许 POST 请求覆盖成的方法
+	overrideMethods []string
+	// 如果为 true, 使用代理转发的主机和方案进行匹配
+	trustProxyHeaders bool
+	// 受信任的代理地址，为空时信任所有代理
+	trustedProxies []*net.IPNet
+	// 主机索引
+	hostIdx atomic.Pointer[hostIndex]
+	// 为每个请求创建 span
+	tracer Tracer
 	// 路由的共享配置
 	routeConf
 }
 
 // ' Router '和' route '之间共享的公共路由配置
 type routeConf struct {
+	// 如果为 true, 没有匹配的 HEAD 请求会回退到对应的 GET 路由
+	autoHead bool
+
 	// 如果为 true, "/path/foo%2Fbar/to" 将匹配路径 "/path/{var}/to"
 	useEncodedPath bool
 
 	// 如果为 true, 当模式为 "/path/"时, 访问 "/path" 反之依然
 	strictSlash bool
 
+	// 尾斜杠策略，为0时由 strictSlash 决定
+	trailingSlash TrailingSlash
+
+	// 如果为 true, 路径中的字面量部分匹配时忽略大小写
+	caseInsensitive bool
+
+	// 如果为 true, 大小写与模板不一致的路径会重定向到模板中的大小写
+	caseRedirect bool
+
 	// 如果为 true, 请求 "/path//to", 访问 "/path//to"，不会清理路径中多余的/
 	skipClean bool
 
+	// 清理路径和尾斜杠重定向使用的状态码，为0时GET和HEAD使用301，其余方法使用308
+	redirectCode int
+
+	// 如果为 true, 清理路径和尾斜杠时在内部改写路径，不再重定向
+	rewritePath bool
+
 	// 来自host和path的变量管理器
 	regexp routeRegexpGroup
 
 	// 匹配器列表
 	matchers []matcher
 
+	// 如果为 true, 拒绝包含未声明查询参数的请求
+	strictQueries bool
+
+	// 严格查询模式下除查询模板外允许的查询参数
+	allowedQueries []string
+
+	// 处理包含未知查询参数的请求
+	unknownQueryFunc UnknownQueryFunc
+
+	// 处理器的超时时间，0表示不限制
+	timeout time.Duration
+
+	// 超时后使用的处理器
+	timeoutHandler http.Handler
+
+	// 请求体的最大字节数，0表示不限制
+	maxBodyBytes int64
+
+	// 授权规则
+	policies []policy
+
+	// 通过 Require 声明的权限范围
+	requiredScopes []string
+
 	// 构建url时使用的方案
 	buildScheme string
 
@@ -76,9 +146,46 @@ func copyRouteConf(r routeConf) routeConf {
 	c.matchers = make([]matcher, len(r.matchers))
 	copy(c.matchers, r.matchers)
 
+	if r.allowedQueries != nil {
+		c.allowedQueries = make([]string, len(r.allowedQueries))
+		copy(c.allowedQueries, r.allowedQueries)
+	}
+
+	if r.policies != nil {
+		c.policies = make([]policy, len(r.policies))
+		copy(c.policies, r.policies)
+	}
+
+	if r.requiredScopes != nil {
+		c.requiredScopes = make([]string, len(r.requiredScopes))
+		copy(c.requiredScopes, r.requiredScopes)
+	}
+
 	return c
 }
 
+// slashPolicy 返回生效的尾斜杠策略
+func (c *routeConf) slashPolicy() TrailingSlash {
+	if c.trailingSlash != 0 {
+		return c.trailingSlash
+	}
+	if c.strictSlash {
+		return TrailingSlashRedirect
+	}
+	return TrailingSlashExact
+}
+
+// redirectStatus 返回给定方法的请求重定向使用的状态码
+func (c *routeConf) redirectStatus(method string) int {
+	if c.redirectCode != 0 {
+		return c.redirectCode
+	}
+	if method == http.MethodGet || method == http.MethodHead {
+		return http.StatusMovedPermanently
+	}
+	return http.StatusPermanentRedirect
+}
+
 func copyRouteRegexp(r *routeRegexp) *routeRegexp {
 	c := *r
 	return &c
@@ -86,10 +193,21 @@ func copyRouteRegexp(r *routeRegexp) *routeRegexp {
 
 // Match 根据路由器注册的路由匹配给定的请求，match参数被填充
 func (r *Router) Match(req *http.Request, match *RouteMatch) bool {
-	for _, route := range r.routes {
+	req = r.withForwarded(req)
+	method := req.Method
+	req = r.overrideMethod(req)
+	for _, route := range r.matchRoutes(req) {
 		if route.Match(req, match) {
+			// 最内层的子路由器先设置
+			if req.Method != method && match.method == "" {
+				match.method = req.Method
+			}
 			// 如果没有发现错误，则构建中间件链
 			if match.MatchErr == nil {
+				// 超时和请求体限制只在最终匹配的路由所在的路由器上设置一次
+				if match.Route == route {
+					match.Handler = route.withBodyLimit(route.withTimeout(match.Handler))
+				}
 				for i := len(r.middlewares) - 1; i >= 0; i-- {
 					match.Handler = r.middlewares[i].Middleware(match.Handler)
 				}
@@ -98,6 +216,16 @@ func (r *Router) Match(req *http.Request, match *RouteMatch) bool {
 		}
 	}
 
+	// 显式注册了 HEAD 的路由优先，其余 HEAD 请求按 GET 重新匹配
+	if r.autoHead && req.Method == http.MethodHead && match.MatchErr == ErrMethodMismatch {
+		var getMatch RouteMatch
+		if r.Match(requestWithMethod(req, http.MethodGet), &getMatch) && getMatch.MatchErr == nil {
+			*match = getMatch
+			match.Handler = headHandler(match.Handler)
+			return true
+		}
+	}
+
 	if match.MatchErr == ErrMethodMismatch {
 		if r.MethodNotAllowedHandler != nil {
 			match.Handler = r.MethodNotAllowedHandler
@@ -119,6 +247,29 @@ func (r *Router) Match(req *http.Request, match *RouteMatch) bool {
 
 // ServeHTTP 分派匹配路由中注册的处理器，当有匹配时，可以调用mux.Vars(request)
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if r.tracer != nil {
+		r.serveTraced(w, req)
+		return
+	}
+	r.servePreMatch(w, req)
+}
+
+// servePreMatch 执行 UsePreMatch 中间件
+func (r *Router) servePreMatch(w http.ResponseWriter, req *http.Request) {
+	if len(r.preMatchMiddlewares) == 0 {
+		r.serveHTTP(w, req)
+		return
+	}
+	var handler http.Handler = http.HandlerFunc(r.serveHTTP)
+	for i := len(r.preMatchMiddlewares) - 1; i >= 0; i-- {
+		handler = r.preMatchMiddlewares[i].Middleware(handler)
+	}
+	handler.ServeHTTP(w, req)
+}
+
+// serveHTTP 清理路径、匹配路由并调用处理器
+func (r *Router) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	req = r.withForwarded(req)
 	if !r.skipClean {
 		path := req.URL.Path
 		if r.useEncodedPath {
@@ -126,21 +277,48 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		}
 		// 清理路径到规范形式并重定向。
 		if p := cleanPath(path); p != path {
-			// http://code.google.com/p/go/issues/detail?id=5252
-			url := *req.URL
-			url.Path = p
-			p = url.String()
-
-			w.Header().Set("Location", p)
-			w.WriteHeader(http.StatusMovedPermanently)
-			return
+			if r.rewritePath {
+				req = requestWithPath(req, p, r.useEncodedPath)
+			} else {
+				// http://code.google.com/p/go/issues/detail?id=5252
+				url := *req.URL
+				url.Path = p
+				p = url.String()
+
+				w.Header().Set("Location", p)
+				w.WriteHeader(r.redirectStatus(req.Method))
+				return
+			}
 		}
 	}
+	req = r.overrideMethod(req)
 	var match RouteMatch
 	var handler http.Handler
-	if r.Match(req, &match) {
+	var start time.Time
+	if r.tracer != nil {
+		start = time.Now()
+	}
+	matched := r.Match(req, &match)
+	if r.tracer != nil {
+		traceMatch(req, &match, start)
+	}
+	recordMatch(req, &match)
+	if matched {
 		handler = match.Handler
+		// 在中间件之前拒绝声明的请求体过大的请求
+		if match.MatchErr == nil && match.Route != nil && match.Route.bodyTooLarge(req) {
+			handler = http.HandlerFunc(entityTooLarge)
+		}
+		if match.rewrite != "" {
+			req = requestWithPath(req, match.rewrite, r.useEncodedPath)
+		}
+		if match.method != "" {
+			req = requestWithMethod(req, match.method)
+		}
 		req = requestWithVars(req, match.Vars)
+		if match.VarsMulti != nil {
+			req = requestWithVarsMulti(req, match.VarsMulti)
+		}
 		req = requestWithRoute(req, match.Route)
 	}
 
@@ -161,8 +339,34 @@ func (r *Router) Get(name string) *Route {
 }
 
 // StrictSlash 定义新路由的尾斜杠行为，默认值为false，子路由会继承此设置
+// 它会覆盖之前通过 TrailingSlash 设置的策略
 func (r *Router) StrictSlash(value bool) *Router {
 	r.strictSlash = value
+	r.trailingSlash = 0
+	return r
+}
+
+// TrailingSlash 尾斜杠策略，决定 "/path" 和 "/path/" 如何匹配以及 URL 如何构建
+type TrailingSlash int
+
+const (
+	// TrailingSlashExact "/path" 和 "/path/" 是不同的路径，等同于 StrictSlash(false)
+	TrailingSlashExact TrailingSlash = iota + 1
+	// TrailingSlashRedirect 两种形式都匹配，重定向到模板中的形式，等同于 StrictSlash(true)
+	TrailingSlashRedirect
+	// TrailingSlashMatchBoth 两种形式都匹配，不重定向
+	TrailingSlashMatchBoth
+	// TrailingSlashRemove 两种形式都匹配，重定向到没有尾斜杠的形式，构建的 URL 也没有尾斜杠
+	TrailingSlashRemove
+	// TrailingSlashAdd 两种形式都匹配，重定向到有尾斜杠的形式，构建的 URL 也有尾斜杠
+	TrailingSlashAdd
+	// TrailingSlashNotFound 只有尾斜杠与模板不同时不匹配并设置 ErrNotFound，后面的路由仍会尝试
+	TrailingSlashNotFound
+)
+
+// TrailingSlash 设置新路由的尾斜杠策略，子路由会继承此设置
+func (r *Router) TrailingSlash(policy TrailingSlash) *Router {
+	r.trailingSlash = policy
 	return r
 }
 
@@ -172,6 +376,85 @@ func (r *Router) SkipClean(value bool) *Router {
 	return r
 }
 
+// RedirectCode 设置清理路径和尾斜杠重定向使用的状态码，可选301、302、307和308
+// 默认GET和HEAD请求使用301，其余方法使用308以保留请求方法和请求体，子路由会继承此设置
+func (r *Router) RedirectCode(code int) *Router {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		r.redirectCode = code
+	default:
+		panic(fmt.Sprintf("mux: invalid redirect status code %d", code))
+	}
+	return r
+}
+
+// RewritePath 清理路径和尾斜杠时在内部改写路径而不是重定向，默认值为false，子路由会继承此设置
+// 处理器和中间件看到的是改写后的规范路径
+func (r *Router) RewritePath(value bool) *Router {
+	r.rewritePath = value
+	return r
+}
+
+// CaseInsensitivePaths 让新路由的路径模板中的字面量部分匹配时忽略大小写
+// 如: "/users/{name}" 会匹配 "/Users/Bob"，变量的正则表达式保持不变，子路由会继承此设置
+func (r *Router) CaseInsensitivePaths() *Router {
+	r.caseInsensitive = true
+	return r
+}
+
+// CanonicalCaseRedirect 忽略大小写匹配时，将大小写与模板不一致的路径重定向到模板中的大小写
+// 默认值为false，子路由会继承此设置
+func (r *Router) CanonicalCaseRedirect(value bool) *Router {
+	r.caseRedirect = value
+	return r
+}
+
+// UnknownQueryHandler 设置新路由在严格查询模式下处理未知查询参数的函数，子路由会继承此设置
+// 参考 Route.StrictQueries()
+func (r *Router) UnknownQueryHandler(f UnknownQueryFunc) *Router {
+	r.unknownQueryFunc = f
+	return r
+}
+
+// AutoHead 让没有匹配的 HEAD 请求回退到对应的 GET 路由，默认值为false，子路由会继承此设置
+// 子路由器在使用自己的 MethodNotAllowedHandler 之前回退，响应体会被丢弃，但保留 Content-Length，显式注册了 HEAD 的路由仍然优先
+func (r *Router) AutoHead(value bool) *Router {
+	r.autoHead = value
+	return r
+}
+
+// MethodOverride 允许 POST 请求通过 X-HTTP-Method-Override 头或 _method 表单字段覆盖方法
+// 表单字段只从 application/x-www-form-urlencoded 请求体的前 methodOverrideMaxBody 字节中读取，不解析 multipart 和查询字符串
+// 只有给定的方法可以作为覆盖目标，没有给定时默认为 PUT、PATCH 和 DELETE
+// 覆盖发生在路由匹配之前，处理器看到的也是覆盖后的方法，在子路由器上设置时只对子路由器中的路由生效
+func (r *Router) MethodOverride(methods ...string) *Router {
+	if len(methods) == 0 {
+		methods = []string{http.MethodPut, http.MethodPatch, http.MethodDelete}
+	}
+	r.overrideMethods = make([]string, len(methods))
+	for k, v := range methods {
+		r.overrideMethods[k] = strings.ToUpper(v)
+	}
+	return r
+}
+
+// overrideMethod 返回按覆盖后的方法匹配的请求，如果没有覆盖则返回原请求
+func (r *Router) overrideMethod(req *http.Request) *http.Request {
+	if len(r.overrideMethods) == 0 || req.Method != http.MethodPost {
+		return req
+	}
+	method := req.Header.Get(methodOverrideHeader)
+	if method == "" {
+		method = overrideFormValue(req)
+	}
+	method = strings.ToUpper(method)
+	if method == "" || !matchInArray(r.overrideMethods, method) {
+		return req
+	}
+	return requestWithMethod(req, method)
+}
+
 // UseEncodedPath 匹配经过编码的原始路径
 // 如： "/path/foo%2Fbar/to" 会匹配到 "/path/{var}/to".
 // 如果没被调用 "/path/foo%2Fbar/to" 匹配到 "/path/foo/bar/to"
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -890,6 +891,317 @@ func TestHost(t *testing.T) {
 	}
 }
 
+func TestHostPort(t *testing.T) {
+	tests := []routeTest{
+		{
+			title:       "IPv6 literal without port in template matches any port",
+			route:       new(Route).Host("[::1]"),
+			request:     newRequestHost("GET", "/", "[::1]:8080"),
+			vars:        map[string]string{},
+			shouldMatch: true,
+		},
+		{
+			title:       "IPv6 literal with port variable",
+			route:       new(Route).Host("[::1]:{port}"),
+			request:     newRequestHost("GET", "/", "[::1]:8080"),
+			vars:        map[string]string{"port": "8080"},
+			shouldMatch: true,
+		},
+		{
+			title:       "Port variable defaults to digits",
+			route:       new(Route).Host("{sub}.example.com:{port}"),
+			request:     newRequestHost("GET", "/", "www.example.com:http"),
+			vars:        map[string]string{},
+			shouldMatch: false,
+		},
+		{
+			title:       "Host and port variables",
+			route:       new(Route).Host("{sub}.example.com:{port}"),
+			request:     newRequestHost("GET", "/", "www.example.com:8443"),
+			vars:        map[string]string{"sub": "www", "port": "8443"},
+			shouldMatch: true,
+		},
+		{
+			title:       "Colon in variable pattern is not a port",
+			route:       new(Route).Host("{v:(?:a|b)}.example.com"),
+			request:     newRequestHost("GET", "/", "a.example.com:8080"),
+			vars:        map[string]string{"v": "a"},
+			shouldMatch: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			testRoute(t, test)
+		})
+	}
+}
+
+func TestHostWildcard(t *testing.T) {
+	tests := []routeTest{
+		{
+			title:        "Single label wildcard",
+			route:        new(Route).Host("*.example.com"),
+			request:      newRequestHost("GET", "/", "api.example.com:8080"),
+			vars:         map[string]string{"*": "api"},
+			host:         "api.example.com",
+			hostTemplate: "*.example.com",
+			shouldMatch:  true,
+		},
+		{
+			title:        "Single label wildcard, multiple labels",
+			route:        new(Route).Host("*.example.com"),
+			request:      newRequestHost("GET", "/", "a.b.example.com"),
+			vars:         map[string]string{},
+			hostTemplate: "*.example.com",
+			shouldMatch:  false,
+		},
+		{
+			title:        "Multi label wildcard",
+			route:        new(Route).Host("**.example.com"),
+			request:      newRequestHost("GET", "/", "a.b.example.com"),
+			vars:         map[string]string{"*": "a.b"},
+			host:         "a.b.example.com",
+			hostTemplate: "**.example.com",
+			shouldMatch:  true,
+		},
+		{
+			title:        "Multi label wildcard, bare domain",
+			route:        new(Route).Host("**.example.com"),
+			request:      newRequestHost("GET", "/", "example.com"),
+			vars:         map[string]string{},
+			hostTemplate: "**.example.com",
+			shouldMatch:  false,
+		},
+		{
+			title:        "Named multi label wildcard",
+			route:        new(Route).Host("{tenant:**}.{region:*}.example.com"),
+			request:      newRequestHost("GET", "/", "a.b.eu.example.com"),
+			vars:         map[string]string{"tenant": "a.b", "region": "eu"},
+			host:         "a.b.eu.example.com",
+			hostTemplate: "{tenant:**}.{region:*}.example.com",
+			shouldMatch:  true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			testRoute(t, test)
+			testTemplate(t, test)
+		})
+	}
+}
+
+func TestHostIndex(t *testing.T) {
+	r := NewRouter()
+	r.Host("first.example.com").Path("/order").Handler(stringHandler("first"))
+	for i := 0; i < 2*hostIndexThreshold; i++ {
+		r.Host(fmt.Sprintf("tenant%d.example.com", i)).Handler(stringHandler(fmt.Sprintf("tenant%d", i)))
+	}
+	r.Host("{sub}.example.com:8080").Handler(stringHandler("port"))
+	r.Host("**.apps.example.com").Handler(stringHandler("apps"))
+	r.Host("{org}.example.org").Handler(stringHandler("org"))
+	r.Path("/any").Handler(stringHandler("any"))
+	r.Host("*.example.com").Handler(stringHandler("wildcard"))
+
+	tests := []struct {
+		host    string
+		path    string
+		expBody string
+	}{
+		{host: "first.example.com", path: "/order", expBody: "first"},
+		{host: "tenant7.example.com", path: "/", expBody: "tenant7"},
+		{host: "tenant7.example.com:8080", path: "/", expBody: "tenant7"},
+		{host: "other.example.com:8080", path: "/", expBody: "port"},
+		{host: "a.b.apps.example.com", path: "/", expBody: "apps"},
+		{host: "acme.example.org", path: "/", expBody: "org"},
+		{host: "tenant7.example.net", path: "/any", expBody: "any"},
+		{host: "first.example.com", path: "/", expBody: "wildcard"},
+		{host: "unknown.example.net", path: "/", expBody: "404 page not found\n"},
+	}
+	for _, test := range tests {
+		res := NewRecorder()
+		r.ServeHTTP(res, newRequestHost("GET", test.path, test.host))
+		if res.Body.String() != test.expBody {
+			t.Errorf("%s%s: expected body %q, got %q", test.host, test.path, test.expBody, res.Body.String())
+		}
+	}
+
+	if idx := r.hostIdx.Load(); idx == nil || idx.indexed < hostIndexThreshold {
+		t.Errorf("Expected host index to be used")
+	}
+
+	r.Host("late.example.com").Handler(stringHandler("late"))
+	r.Host("late.example.net").Handler(stringHandler("late"))
+	res := NewRecorder()
+	r.ServeHTTP(res, newRequestHost("GET", "/", "late.example.com"))
+	if res.Body.String() != "wildcard" {
+		t.Errorf("Expected earlier wildcard route to win, got %q", res.Body.String())
+	}
+	res = NewRecorder()
+	r.ServeHTTP(res, newRequestHost("GET", "/", "late.example.net"))
+	if res.Body.String() != "late" {
+		t.Errorf("Expected route added after first match to be indexed, got %q", res.Body.String())
+	}
+}
+
+func TestTrustProxyHeaders(t *testing.T) {
+	newRouter := func(trust bool) *Router {
+		r := NewRouter().TrustProxyHeaders(trust)
+		r.Host("{sub}.example.com").Schemes("https").HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			fmt.Fprint(w, Vars(req)["sub"])
+		})
+		return r
+	}
+
+	tests := []struct {
+		title   string
+		trust   bool
+		headers []string
+		expCode int
+		expBody string
+	}{
+		{title: "untrusted", trust: false, headers: []string{"X-Forwarded-Host", "api.example.com", "X-Forwarded-Proto", "https"}, expCode: http.StatusNotFound},
+		{title: "X-Forwarded-*", trust: true, headers: []string{"X-Forwarded-Host", "api.example.com", "X-Forwarded-Proto", "HTTPS"}, expCode: http.StatusOK, expBody: "api"},
+		{title: "Forwarded", trust: true, headers: []string{"Forwarded", `for=192.0.2.1;host="www.example.com:443";proto=https`}, expCode: http.StatusOK, expBody: "www"},
+		{title: "last proxy wins", trust: true, headers: []string{"X-Forwarded-Host", "evil.test, app.example.com", "X-Forwarded-Proto", "http, https"}, expCode: http.StatusOK, expBody: "app"},
+		{title: "missing proto", trust: true, headers: []string{"X-Forwarded-Host", "api.example.com"}, expCode: http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			req := newRequestWithHeaders("GET", "http://internal.local/", test.headers...)
+			res := NewRecorder()
+			newRouter(test.trust).ServeHTTP(res, req)
+			if res.Code != test.expCode {
+				t.Errorf("Expected status code %d, got %d", test.expCode, res.Code)
+			}
+			if test.expBody != "" && res.Body.String() != test.expBody {
+				t.Errorf("Expected body %q, got %q", test.expBody, res.Body.String())
+			}
+		})
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	r := NewRouter()
+	if err := r.TrustedProxies("10.0.0.0/8", "192.168.1.1", "fd00::/8"); err != nil {
+		t.Fatal(err)
+	}
+	r.Schemes("https").Handler(stringHandler("secure"))
+
+	tests := []struct {
+		remoteAddr string
+		expCode    int
+	}{
+		{remoteAddr: "10.1.2.3:1234", expCode: http.StatusOK},
+		{remoteAddr: "192.168.1.1:1234", expCode: http.StatusOK},
+		{remoteAddr: "[fd00::1]:1234", expCode: http.StatusOK},
+		{remoteAddr: "192.168.1.2:1234", expCode: http.StatusNotFound},
+		{remoteAddr: "203.0.113.7:1234", expCode: http.StatusNotFound},
+		{remoteAddr: "garbage", expCode: http.StatusNotFound},
+	}
+	for _, test := range tests {
+		req := newRequestWithHeaders("GET", "http://localhost/", "X-Forwarded-Proto", "https")
+		req.RemoteAddr = test.remoteAddr
+		res := NewRecorder()
+		r.ServeHTTP(res, req)
+		if res.Code != test.expCode {
+			t.Errorf("%s: expected status code %d, got %d", test.remoteAddr, test.expCode, res.Code)
+		}
+	}
+
+	if err := NewRouter().TrustedProxies("10.0.0.0/33"); err == nil {
+		t.Errorf("Expected error for invalid CIDR")
+	}
+	if err := NewRouter().TrustedProxies("not-an-ip"); err == nil {
+		t.Errorf("Expected error for invalid IP")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	r := NewRouter()
+	if err := r.TrustedProxies("10.0.0.0/8"); err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	r.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
+		got = ClientIP(req).String()
+	})
+
+	tests := []struct {
+		remoteAddr string
+		header     string
+		value      string
+		expIP      string
+	}{
+		{"10.0.0.1:1234", "X-Forwarded-For", "203.0.113.7, 10.0.0.2", "203.0.113.7"},
+		{"10.0.0.1:1234", "X-Forwarded-For", "198.51.100.1, 203.0.113.7", "203.0.113.7"},
+		{"10.0.0.1:1234", "Forwarded", `for=198.51.100.1, for="[2001:db8::1]:4711"`, "2001:db8::1"},
+		{"203.0.113.9:1234", "X-Forwarded-For", "198.51.100.1", "203.0.113.9"},
+		{"10.0.0.1:1234", "X-Forwarded-For", "", "10.0.0.1"},
+	}
+	for _, test := range tests {
+		req := newRequestWithHeaders("GET", "http://localhost/", test.header, test.value)
+		req.RemoteAddr = test.remoteAddr
+		r.ServeHTTP(NewRecorder(), req)
+		if got != test.expIP {
+			t.Errorf("%s %s: expected client IP %s, got %s", test.remoteAddr, test.value, test.expIP, got)
+		}
+	}
+}
+
+func TestRouteMetadata(t *testing.T) {
+	r := NewRouter()
+	route := r.NewRoute().Metadata("tier", "gold").Metadata(1, 2)
+
+	if v, err := route.GetMetadataValue("tier"); err != nil || v != "gold" {
+		t.Errorf("Expected gold, got %v %v", v, err)
+	}
+	if _, err := route.GetMetadataValue("missing"); err != ErrMetadataKeyNotFound {
+		t.Errorf("Expected ErrMetadataKeyNotFound, got %v", err)
+	}
+	if v := route.GetMetadataValueOr("missing", "fallback"); v != "fallback" {
+		t.Errorf("Expected fallback, got %v", v)
+	}
+	if !route.MetadataContains(1) || len(route.GetMetadata()) != 2 {
+		t.Errorf("Unexpected metadata %v", route.GetMetadata())
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	r := NewRouter()
+	if err := r.TrustedProxies("10.0.0.0/8"); err != nil {
+		t.Fatal(err)
+	}
+	r.RedirectToHTTPS()
+	r.HandleFunc("/orders", stringHandler("orders"))
+
+	tests := []struct {
+		title       string
+		method      string
+		headers     []string
+		expCode     int
+		expLocation string
+	}{
+		{title: "plain http", method: "GET", expCode: http.StatusMovedPermanently, expLocation: "https://example.com/orders?id=1"},
+		{title: "plain http POST", method: "POST", expCode: http.StatusPermanentRedirect, expLocation: "https://example.com/orders?id=1"},
+		{title: "forwarded https", method: "GET", headers: []string{"X-Forwarded-Proto", "https"}, expCode: http.StatusOK},
+		{title: "forwarded http", method: "GET", headers: []string{"X-Forwarded-Proto", "http", "X-Forwarded-Host", "shop.example.com"}, expCode: http.StatusMovedPermanently, expLocation: "https://shop.example.com/orders?id=1"},
+	}
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			req := newRequestWithHeaders(test.method, "http://example.com:8080/orders?id=1", test.headers...)
+			req.RemoteAddr = "10.0.0.1:1234"
+			res := NewRecorder()
+			r.ServeHTTP(res, req)
+			if res.Code != test.expCode {
+				t.Errorf("Expected status code %d, got %d", test.expCode, res.Code)
+			}
+			if got := res.HeaderMap.Get("Location"); got != test.expLocation {
+				t.Errorf("Expected Location %q, got %q", test.expLocation, got)
+			}
+		})
+	}
+}
+
 func TestPath(t *testing.T) {
 	tests := []routeTest{
 		{
@@ -1738,6 +2050,154 @@ func TestQueries(t *testing.T) {
 	}
 }
 
+func TestQueriesMultiValue(t *testing.T) {
+	r := NewRouter()
+	route := r.HandleFunc("/items", func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, strings.Join(VarsMulti(req)["tags"], ","), " ", Vars(req)["tags"])
+	}).Queries("tag", "{tags[]:[a-z ]+}")
+
+	tests := []struct {
+		query   string
+		expCode int
+		expBody string
+	}{
+		{query: "tag=a", expCode: http.StatusOK, expBody: "a a"},
+		{query: "tag=a&x=1&tag=b", expCode: http.StatusOK, expBody: "a,b a"},
+		{query: "tag=a&tag=B", expCode: http.StatusNotFound},
+		{query: "x=1", expCode: http.StatusNotFound},
+	}
+	for _, test := range tests {
+		res := NewRecorder()
+		r.ServeHTTP(res, newRequest("GET", "http://localhost/items?"+test.query))
+		if res.Code != test.expCode {
+			t.Errorf("%s: expected status code %d, got %d", test.query, test.expCode, res.Code)
+		}
+		if test.expBody != "" && res.Body.String() != test.expBody {
+			t.Errorf("%s: expected body %q, got %q", test.query, test.expBody, res.Body.String())
+		}
+	}
+
+	u, err := route.URL("tags", "a", "tags", "b c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.RawQuery != "tag=a&tag=b+c" {
+		t.Errorf("Expected query %q, got %q", "tag=a&tag=b+c", u.RawQuery)
+	}
+	if _, err := route.URL("tags", "a", "tags", "B"); err == nil {
+		t.Errorf("Expected error for value not matching the variable pattern")
+	}
+	if _, err := route.URL(); err == nil {
+		t.Errorf("Expected error for missing variable")
+	}
+
+	if err := new(Route).Queries("tag", "x{tags[]}").GetError(); err == nil {
+		t.Errorf("Expected error for multi-value variable that is not the whole query value")
+	}
+}
+
+func TestQueriesOptional(t *testing.T) {
+	r := NewRouter()
+	route := r.HandleFunc("/items", func(w http.ResponseWriter, req *http.Request) {
+		vars := Vars(req)
+		fmt.Fprint(w, vars["page"], " ", vars["sort"], " ", strings.Join(VarsMulti(req)["tags"], ","))
+	}).Queries("page", "{page=1:[0-9]+}", "sort", "{sort=}", "tag", "{tags[]=all}")
+
+	tests := []struct {
+		query   string
+		expCode int
+		expBody string
+	}{
+		{query: "", expCode: http.StatusOK, expBody: "1  all"},
+		{query: "page=3&sort=name&tag=a&tag=b", expCode: http.StatusOK, expBody: "3 name a,b"},
+		{query: "page=x", expCode: http.StatusNotFound},
+		{query: "page=", expCode: http.StatusNotFound},
+	}
+	for _, test := range tests {
+		res := NewRecorder()
+		r.ServeHTTP(res, newRequest("GET", "http://localhost/items?"+test.query))
+		if res.Code != test.expCode {
+			t.Errorf("%q: expected status code %d, got %d", test.query, test.expCode, res.Code)
+		}
+		if test.expBody != "" && res.Body.String() != test.expBody {
+			t.Errorf("%q: expected body %q, got %q", test.query, test.expBody, res.Body.String())
+		}
+	}
+
+	urlTests := []struct {
+		pairs    []string
+		expQuery string
+	}{
+		{pairs: nil, expQuery: ""},
+		{pairs: []string{"page", "1", "sort", "", "tags", "all"}, expQuery: ""},
+		{pairs: []string{"page", "2", "tags", "a", "tags", "b"}, expQuery: "page=2&tag=a&tag=b"},
+		{pairs: []string{"sort", "name"}, expQuery: "sort=name"},
+	}
+	for _, test := range urlTests {
+		u, err := route.URL(test.pairs...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.RawQuery != test.expQuery {
+			t.Errorf("%v: expected query %q, got %q", test.pairs, test.expQuery, u.RawQuery)
+		}
+	}
+
+	if err := new(Route).Queries("page", "{page=x:[0-9]+}").GetError(); err == nil {
+		t.Errorf("Expected error for default value not matching the pattern")
+	}
+}
+
+func TestStrictQueries(t *testing.T) {
+	r := NewRouter()
+	r.HandleFunc("/items", stringHandler("items")).
+		Queries("page", "{page=1:[0-9]+}").
+		StrictQueries("debug")
+	r.HandleFunc("/loose", stringHandler("loose"))
+
+	tests := []struct {
+		path    string
+		expCode int
+		expBody string
+	}{
+		{path: "/items?page=2&debug=1", expCode: http.StatusOK, expBody: "items"},
+		{path: "/items", expCode: http.StatusOK, expBody: "items"},
+		{path: "/items?pgae=2&x=1&pgae=3", expCode: http.StatusBadRequest, expBody: "unknown query parameters: pgae, x\n"},
+		{path: "/loose?anything=1", expCode: http.StatusOK, expBody: "loose"},
+	}
+	for _, test := range tests {
+		res := NewRecorder()
+		r.ServeHTTP(res, newRequest("GET", "http://localhost"+test.path))
+		if res.Code != test.expCode {
+			t.Errorf("%s: expected status code %d, got %d", test.path, test.expCode, res.Code)
+		}
+		if res.Body.String() != test.expBody {
+			t.Errorf("%s: expected body %q, got %q", test.path, test.expBody, res.Body.String())
+		}
+	}
+
+	t.Run("custom handler inherited by subrouter", func(t *testing.T) {
+		r := NewRouter()
+		r.UnknownQueryHandler(func(w http.ResponseWriter, req *http.Request, unknown []string) {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprint(w, strings.Join(unknown, "|"))
+		})
+		s := r.PathPrefix("/api").Queries("v", "{v}").StrictQueries().Subrouter()
+		s.HandleFunc("/items", stringHandler("items")).Queries("page", "{page}")
+
+		res := NewRecorder()
+		r.ServeHTTP(res, newRequest("GET", "http://localhost/api/items?v=1&page=2"))
+		if res.Code != http.StatusOK {
+			t.Errorf("Expected status code 200, got %d", res.Code)
+		}
+		res = NewRecorder()
+		r.ServeHTTP(res, newRequest("GET", "http://localhost/api/items?v=1&page=2&a=1&b=2"))
+		if res.Code != http.StatusUnprocessableEntity || res.Body.String() != "a|b" {
+			t.Errorf("Expected custom handler, got %d %q", res.Code, res.Body.String())
+		}
+	})
+}
+
 func TestSchemes(t *testing.T) {
 	tests := []routeTest{
 
@@ -2204,6 +2664,101 @@ func TestStrictSlash(t *testing.T) {
 	}
 }
 
+func TestTrailingSlashPolicy(t *testing.T) {
+	tests := []struct {
+		title       string
+		policy      TrailingSlash
+		template    string
+		path        string
+		expCode     int
+		expLocation string
+		expURL      string
+	}{
+		{title: "exact, same", policy: TrailingSlashExact, template: "/a/", path: "/a/", expCode: http.StatusOK, expURL: "/a/"},
+		{title: "exact, different", policy: TrailingSlashExact, template: "/a/", path: "/a", expCode: http.StatusNotFound, expURL: "/a/"},
+		{title: "redirect", policy: TrailingSlashRedirect, template: "/a/", path: "/a", expCode: http.StatusMovedPermanently, expLocation: "/a/", expURL: "/a/"},
+		{title: "match both, with slash", policy: TrailingSlashMatchBoth, template: "/a", path: "/a/", expCode: http.StatusOK, expURL: "/a"},
+		{title: "match both, without slash", policy: TrailingSlashMatchBoth, template: "/a/", path: "/a", expCode: http.StatusOK, expURL: "/a/"},
+		{title: "remove, with slash", policy: TrailingSlashRemove, template: "/a/", path: "/a/", expCode: http.StatusMovedPermanently, expLocation: "/a", expURL: "/a"},
+		{title: "remove, without slash", policy: TrailingSlashRemove, template: "/a/", path: "/a", expCode: http.StatusOK, expURL: "/a"},
+		{title: "remove, root", policy: TrailingSlashRemove, template: "/", path: "/", expCode: http.StatusOK, expURL: "/"},
+		{title: "add, without slash", policy: TrailingSlashAdd, template: "/a/{b}", path: "/a/x", expCode: http.StatusMovedPermanently, expLocation: "/a/x/", expURL: "/a/x/"},
+		{title: "add, with slash", policy: TrailingSlashAdd, template: "/a/{b}", path: "/a/x/", expCode: http.StatusOK, expURL: "/a/x/"},
+		{title: "not found, different", policy: TrailingSlashNotFound, template: "/a", path: "/a/", expCode: http.StatusNotFound, expURL: "/a"},
+		{title: "not found, same", policy: TrailingSlashNotFound, template: "/a", path: "/a", expCode: http.StatusOK, expURL: "/a"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			r := NewRouter().TrailingSlash(test.policy)
+			route := r.Handle(test.template, stringHandler("ok"))
+
+			res := NewRecorder()
+			r.ServeHTTP(res, newRequest("GET", test.path))
+			if res.Code != test.expCode {
+				t.Errorf("Expected status code %d, got %d", test.expCode, res.Code)
+			}
+			if got := res.HeaderMap.Get("Location"); got != test.expLocation {
+				t.Errorf("Expected Location %q, got %q", test.expLocation, got)
+			}
+			u, err := route.URL("b", "x")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u.Path != test.expURL {
+				t.Errorf("Expected URL %q, got %q", test.expURL, u.Path)
+			}
+		})
+	}
+
+	t.Run("per route", func(t *testing.T) {
+		r := NewRouter().StrictSlash(true)
+		r.Handle("/a/", stringHandler("a")).TrailingSlash(TrailingSlashMatchBoth)
+		r.Handle("/b/", stringHandler("b"))
+
+		res := NewRecorder()
+		r.ServeHTTP(res, newRequest("GET", "/a"))
+		if res.Code != http.StatusOK {
+			t.Errorf("Expected status code 200, got %d", res.Code)
+		}
+		res = NewRecorder()
+		r.ServeHTTP(res, newRequest("GET", "/b"))
+		if res.Code != http.StatusMovedPermanently {
+			t.Errorf("Expected status code 301, got %d", res.Code)
+		}
+	})
+
+	t.Run("not found tries later routes", func(t *testing.T) {
+		r := NewRouter()
+		r.NotFoundHandler = stringHandler("custom 404")
+		r.Handle("/a", stringHandler("a")).TrailingSlash(TrailingSlashNotFound)
+		r.Handle("/a/", stringHandler("a/"))
+		b := r.Handle("/b", stringHandler("b")).TrailingSlash(TrailingSlashNotFound)
+
+		tests := []struct {
+			path    string
+			expBody string
+		}{
+			{path: "/a", expBody: "a"},
+			{path: "/a/", expBody: "a/"},
+			{path: "/b", expBody: "b"},
+			{path: "/b/", expBody: "custom 404"},
+		}
+		for _, test := range tests {
+			res := NewRecorder()
+			r.ServeHTTP(res, newRequest("GET", test.path))
+			if res.Body.String() != test.expBody {
+				t.Errorf("%s: expected body %q, got %q", test.path, test.expBody, res.Body.String())
+			}
+		}
+
+		var match RouteMatch
+		if b.Match(newRequest("GET", "/b/"), &match) || match.MatchErr != ErrNotFound {
+			t.Errorf("Expected ErrNotFound, got %v", match.MatchErr)
+		}
+	})
+}
+
 func TestUseEncodedPath(t *testing.T) {
 	r := NewRouter()
 	r.UseEncodedPath()
@@ -2658,6 +3213,145 @@ func TestSkipClean(t *testing.T) {
 	}
 }
 
+func TestRedirectCode(t *testing.T) {
+	tests := []struct {
+		title   string
+		code    int
+		method  string
+		path    string
+		expCode int
+	}{
+		{title: "clean path GET default", method: "GET", path: "//api/", expCode: http.StatusMovedPermanently},
+		{title: "clean path POST default", method: "POST", path: "//api/", expCode: http.StatusPermanentRedirect},
+		{title: "clean path custom", code: http.StatusFound, method: "POST", path: "//api/", expCode: http.StatusFound},
+		{title: "strict slash GET default", method: "GET", path: "/api", expCode: http.StatusMovedPermanently},
+		{title: "strict slash PUT default", method: "PUT", path: "/api", expCode: http.StatusPermanentRedirect},
+		{title: "strict slash custom", code: http.StatusTemporaryRedirect, method: "GET", path: "/api", expCode: http.StatusTemporaryRedirect},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			r := NewRouter().StrictSlash(true)
+			if test.code != 0 {
+				r.RedirectCode(test.code)
+			}
+			r.HandleFunc("/api/", dummyHandler)
+
+			res := NewRecorder()
+			r.ServeHTTP(res, newRequest(test.method, "http://localhost"+test.path))
+			if res.Code != test.expCode {
+				t.Errorf("Expected status code %d, got %d", test.expCode, res.Code)
+			}
+		})
+	}
+
+	t.Run("invalid code panics", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Expected panic for invalid redirect code")
+			}
+		}()
+		NewRouter().RedirectCode(http.StatusOK)
+	})
+}
+
+func TestRewritePath(t *testing.T) {
+	r := NewRouter().StrictSlash(true).RewritePath(true)
+	r.HandleFunc("/api/{id}/", func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, req.URL.Path, " ", Vars(req)["id"])
+	})
+
+	tests := []struct {
+		path    string
+		expBody string
+	}{
+		{path: "//api/1/", expBody: "/api/1/ 1"},
+		{path: "/api/2", expBody: "/api/2/ 2"},
+		{path: "/api/./3/", expBody: "/api/3/ 3"},
+	}
+
+	for _, test := range tests {
+		res := NewRecorder()
+		r.ServeHTTP(res, newRequest("POST", "http://localhost"+test.path))
+		if res.Code != http.StatusOK {
+			t.Errorf("%s: expected status code 200, got %d", test.path, res.Code)
+		}
+		if res.Body.String() != test.expBody {
+			t.Errorf("%s: expected body %q, got %q", test.path, test.expBody, res.Body.String())
+		}
+	}
+
+	t.Run("canonical case", func(t *testing.T) {
+		r := NewRouter().CaseInsensitivePaths().CanonicalCaseRedirect(true).RewritePath(true)
+		r.HandleFunc("/users/{name}", func(w http.ResponseWriter, req *http.Request) {
+			fmt.Fprint(w, req.URL.Path)
+		})
+		res := NewRecorder()
+		r.ServeHTTP(res, newRequest("GET", "http://localhost/USERS/Bob"))
+		if res.Body.String() != "/users/Bob" {
+			t.Errorf("expected body %q, got %q", "/users/Bob", res.Body.String())
+		}
+	})
+}
+
+func TestCaseInsensitivePaths(t *testing.T) {
+	r := NewRouter().CaseInsensitivePaths()
+	r.HandleFunc("/users/{name}/profile", func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, Vars(req)["name"])
+	})
+	r.HandleFunc("/ids/{id:[a-z]+}", stringHandler("id"))
+	r.PathPrefix("/static/").Handler(stringHandler("static"))
+
+	tests := []struct {
+		path    string
+		expCode int
+		expBody string
+	}{
+		{path: "/users/Bob/profile", expCode: http.StatusOK, expBody: "Bob"},
+		{path: "/Users/Bob/PROFILE", expCode: http.StatusOK, expBody: "Bob"},
+		{path: "/IDS/abc", expCode: http.StatusOK},
+		{path: "/ids/ABC", expCode: http.StatusNotFound},
+		{path: "/Static/app.js", expCode: http.StatusOK, expBody: "static"},
+	}
+	for _, test := range tests {
+		res := NewRecorder()
+		r.ServeHTTP(res, newRequest("GET", "http://localhost"+test.path))
+		if res.Code != test.expCode {
+			t.Errorf("%s: expected status code %d, got %d", test.path, test.expCode, res.Code)
+		}
+		if test.expBody != "" && res.Body.String() != test.expBody {
+			t.Errorf("%s: expected body %q, got %q", test.path, test.expBody, res.Body.String())
+		}
+	}
+
+	t.Run("canonical case redirect", func(t *testing.T) {
+		r := NewRouter().CaseInsensitivePaths().CanonicalCaseRedirect(true).StrictSlash(true)
+		r.HandleFunc("/Users/{name}/profile/", dummyHandler)
+		r.PathPrefix("/static/").Handler(stringHandler("static"))
+		// 子路由器中的路由一次重定向到完整的规范路径
+		r.PathPrefix("/API").Subrouter().HandleFunc("/Users", dummyHandler)
+
+		tests := []struct {
+			path        string
+			expLocation string
+		}{
+			{path: "/users/Bob/PROFILE/?a=b", expLocation: "http://localhost/Users/Bob/profile/?a=b"},
+			{path: "/users/Bob/profile", expLocation: "http://localhost/Users/Bob/profile/"},
+			{path: "/Users/Bob/profile/", expLocation: ""},
+			{path: "/STATIC/App.js", expLocation: "http://localhost/static/App.js"},
+			{path: "/api/users", expLocation: "http://localhost/API/Users"},
+			{path: "/API/Users", expLocation: ""},
+		}
+		for _, test := range tests {
+			res := NewRecorder()
+			r.ServeHTTP(res, newRequest("GET", "http://localhost"+test.path))
+			if got := res.HeaderMap.Get("Location"); got != test.expLocation {
+				t.Errorf("%s: expected Location %q, got %q", test.path, test.expLocation, got)
+			}
+		}
+	})
+}
+
 func TestSubrouterHeader(t *testing.T) {
 	expected := "func1 response"
 	func1 := func(w http.ResponseWriter, r *http.Request) {
@@ -3364,6 +4058,188 @@ func TestMethodNotAllowed(t *testing.T) {
 	}
 }
 
+func TestAutoHead(t *testing.T) {
+	get := func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, "get body") }
+	head := func(w http.ResponseWriter, r *http.Request) { w.Header().Set("X-Head", "explicit") }
+
+	router := NewRouter().AutoHead(true)
+	router.HandleFunc("/thing", get).Methods(http.MethodGet)
+	router.HandleFunc("/other", get).Methods(http.MethodGet)
+	router.HandleFunc("/other", head).Methods(http.MethodHead)
+	router.HandleFunc("/post", get).Methods(http.MethodPost)
+	router.PathPrefix("/sub").Subrouter().HandleFunc("/thing", get).Methods(http.MethodGet)
+	strict := router.PathPrefix("/strict").Subrouter()
+	strict.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	strict.HandleFunc("/thing", get).Methods(http.MethodGet)
+	strict.HandleFunc("/post", get).Methods(http.MethodPost)
+
+	t.Run("falls back to GET", func(t *testing.T) {
+		for _, path := range []string{"/thing", "/sub/thing", "/strict/thing"} {
+			w := NewRecorder()
+			router.ServeHTTP(w, newRequest(http.MethodHead, path))
+			if w.Code != http.StatusOK {
+				t.Fatalf("%s: expected status code 200 (got %d)", path, w.Code)
+			}
+			if w.Body.Len() != 0 {
+				t.Errorf("%s: expected empty body, got %q", path, w.Body.String())
+			}
+			if got := w.HeaderMap.Get("Content-Length"); got != "8" {
+				t.Errorf("%s: expected Content-Length 8, got %q", path, got)
+			}
+		}
+	})
+
+	t.Run("explicit HEAD route takes priority", func(t *testing.T) {
+		w := NewRecorder()
+		router.ServeHTTP(w, newRequest(http.MethodHead, "/other"))
+		if w.HeaderMap.Get("X-Head") != "explicit" {
+			t.Errorf("Expected explicit HEAD handler to be called")
+		}
+	})
+
+	t.Run("no GET route", func(t *testing.T) {
+		w := NewRecorder()
+		router.ServeHTTP(w, newRequest(http.MethodHead, "/post"))
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("Expected status code 405 (got %d)", w.Code)
+		}
+		w = NewRecorder()
+		router.ServeHTTP(w, newRequest(http.MethodHead, "/strict/post"))
+		if w.Code != http.StatusTeapot {
+			t.Errorf("Expected subrouter MethodNotAllowedHandler (got %d)", w.Code)
+		}
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		r := NewRouter()
+		r.HandleFunc("/thing", get).Methods(http.MethodGet)
+		w := NewRecorder()
+		r.ServeHTTP(w, newRequest(http.MethodHead, "/thing"))
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("Expected status code 405 (got %d)", w.Code)
+		}
+	})
+}
+
+func TestMethodOverride(t *testing.T) {
+	router := NewRouter().MethodOverride(http.MethodPut, http.MethodDelete)
+	router.HandleFunc("/thing", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Method)
+	}).Methods(http.MethodPut, http.MethodDelete, http.MethodPost)
+
+	tests := []struct {
+		title   string
+		method  string
+		header  string
+		form    string
+		expBody string
+	}{
+		{title: "header", method: http.MethodPost, header: "put", expBody: http.MethodPut},
+		{title: "form field", method: http.MethodPost, form: "_method=DELETE", expBody: http.MethodDelete},
+		{title: "header wins over form", method: http.MethodPost, header: "PUT", form: "_method=DELETE", expBody: http.MethodPut},
+		{title: "not allow-listed", method: http.MethodPost, header: http.MethodPatch, expBody: http.MethodPost},
+		{title: "only POST is overridden", method: http.MethodPut, header: http.MethodDelete, expBody: http.MethodPut},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, "/thing", strings.NewReader(test.form))
+			if test.form != "" {
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			if test.header != "" {
+				req.Header.Set("X-HTTP-Method-Override", test.header)
+			}
+			w := NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Body.String() != test.expBody {
+				t.Errorf("Expected method %q, got %q", test.expBody, w.Body.String())
+			}
+		})
+	}
+
+	t.Run("query string is ignored", func(t *testing.T) {
+		w := NewRecorder()
+		router.ServeHTTP(w, newRequest(http.MethodPost, "/thing?_method=DELETE"))
+		if w.Body.String() != http.MethodPost {
+			t.Errorf("Expected method %q, got %q", http.MethodPost, w.Body.String())
+		}
+	})
+
+	t.Run("form body is still readable", func(t *testing.T) {
+		r := NewRouter().MethodOverride()
+		r.HandleFunc("/thing", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, r.Method, " ", r.PostFormValue("name"))
+		}).Methods(http.MethodPut)
+		req := httptest.NewRequest(http.MethodPost, "/thing", strings.NewReader("_method=PUT&name=gopher"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Body.String() != "PUT gopher" {
+			t.Errorf("Expected %q, got %q", "PUT gopher", w.Body.String())
+		}
+	})
+
+	t.Run("multipart body does not bypass MaxBodyBytes", func(t *testing.T) {
+		r := NewRouter().MethodOverride()
+		r.HandleFunc("/thing", dummyHandler).Methods(http.MethodPost, http.MethodDelete).MaxBodyBytes(10)
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("_method", http.MethodDelete)
+		fw, _ := mw.CreateFormFile("file", "big.bin")
+		fw.Write(make([]byte, 1<<20))
+		mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/thing", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected status %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+		}
+		if req.MultipartForm != nil || req.Form != nil {
+			t.Error("Expected the request body not to be parsed")
+		}
+	})
+
+	t.Run("subrouter", func(t *testing.T) {
+		r := NewRouter()
+		api := r.PathPrefix("/api").Subrouter().MethodOverride()
+		api.HandleFunc("/x", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, r.Method)
+		}).Methods(http.MethodDelete)
+		r.HandleFunc("/x", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, r.Method)
+		})
+
+		tests := []struct {
+			path    string
+			expBody string
+		}{
+			{path: "/api/x", expBody: http.MethodDelete},
+			{path: "/x", expBody: http.MethodPost},
+		}
+		for _, test := range tests {
+			w := NewRecorder()
+			r.ServeHTTP(w, newRequestWithHeaders(http.MethodPost, test.path, "X-HTTP-Method-Override", http.MethodDelete))
+			if w.Body.String() != test.expBody {
+				t.Errorf("%s: expected method %q, got %q", test.path, test.expBody, w.Body.String())
+			}
+		}
+	})
+
+	t.Run("Match uses overridden method", func(t *testing.T) {
+		r := NewRouter().MethodOverride()
+		r.HandleFunc("/thing", dummyHandler).Methods(http.MethodPatch)
+		req := newRequestWithHeaders(http.MethodPost, "/thing", "X-HTTP-Method-Override", http.MethodPatch)
+		var match RouteMatch
+		if !r.Match(req, &match) {
+			t.Errorf("Expected overridden request to match, got %v", match.MatchErr)
+		}
+	})
+}
+
 type customMethodNotAllowedHandler struct {
 	msg string
 }
@@ -0,0 +1,232 @@
+package mux
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// forwarded 保存从代理请求头中解析出的原始主机、方案和客户端地址
+type forwarded struct {
+	host     string
+	scheme   string
+	clientIP net.IP
+}
+
+// TrustProxyHeaders 信任 Forwarded、X-Forwarded-Host、X-Forwarded-Proto 和 X-Forwarded-For 请求头，默认值为false
+// 启用后，Host 和 Schemes 匹配以及主机变量都使用代理转发的主机和方案，ClientIP 返回转发的客户端地址
+// 只应在路由器部署于会覆盖这些请求头的代理之后时启用
+func (r *Router) TrustProxyHeaders(value bool) *Router {
+	r.trustProxyHeaders = value
+	return r
+}
+
+// TrustedProxies 只信任来自给定地址的代理请求头，地址可以是CIDR或单个IP
+// 如: "10.0.0.0/8", "192.168.1.1", "fd00::/8"，不传参数时不再信任任何代理
+func (r *Router) TrustedProxies(cidrs ...string) error {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return fmt.Errorf("mux: invalid trusted proxy address %q", cidr)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("mux: invalid trusted proxy address %q", cidr)
+		}
+		nets = append(nets, n)
+	}
+	r.trustedProxies = nets
+	r.trustProxyHeaders = len(nets) > 0
+	return nil
+}
+
+// trustsProxy 如果应该信任请求中的代理请求头，则返回true
+func (r *Router) trustsProxy(req *http.Request) bool {
+	if !r.trustProxyHeaders {
+		return false
+	}
+	if len(r.trustedProxies) == 0 {
+		return true
+	}
+	ip := remoteIP(req)
+	return ip != nil && r.isTrustedProxy(ip)
+}
+
+// remoteIP 返回直接连接的对端地址
+func remoteIP(req *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// RedirectToHTTPS 注册一个将 http 请求重定向到相同主机和路径的 https 的路由
+// 信任代理时使用转发的方案和主机判断，它应该在其他路由之前注册
+func (r *Router) RedirectToHTTPS() *Route {
+	route := r.NewRoute().Schemes("http")
+	return route.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		host, _ := splitHostPort(getHost(req))
+		u := "https://" + host + req.URL.RequestURI()
+		http.Redirect(w, req, u, route.redirectStatus(req.Method))
+	})
+}
+
+// withForwarded 在信任代理时将转发的主机、方案和客户端地址保存到请求上下文中
+func (r *Router) withForwarded(req *http.Request) *http.Request {
+	if forwardedFrom(req) != nil || !r.trustsProxy(req) {
+		return req
+	}
+	f := parseForwarded(req.Header)
+	f.clientIP = r.forwardedClientIP(req.Header)
+	ctx := context.WithValue(req.Context(), forwardedKey, f)
+	return req.WithContext(ctx)
+}
+
+// forwardedClientIP 从右向左遍历 Forwarded 或 X-Forwarded-For 中的地址，
+// 跳过受信任的代理，返回第一个不受信任的地址。信任所有代理时返回最后一个地址
+func (r *Router) forwardedClientIP(h http.Header) net.IP {
+	addrs := forwardedFor(h)
+	for i := len(addrs) - 1; i >= 0; i-- {
+		ip := parseForwardedIP(addrs[i])
+		if ip == nil {
+			return nil
+		}
+		if i == 0 || len(r.trustedProxies) == 0 || !r.isTrustedProxy(ip) {
+			return ip
+		}
+	}
+	return nil
+}
+
+// isTrustedProxy 如果地址属于受信任的代理，则返回true
+func (r *Router) isTrustedProxy(ip net.IP) bool {
+	for _, n := range r.trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedFor 按顺序返回代理请求头中记录的客户端地址，优先使用 Forwarded
+func forwardedFor(h http.Header) []string {
+	var addrs []string
+	for _, v := range h.Values("Forwarded") {
+		for _, elem := range strings.Split(v, ",") {
+			for _, pair := range strings.Split(elem, ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					addrs = append(addrs, strings.Trim(value, `"`))
+				}
+			}
+		}
+	}
+	if len(addrs) > 0 {
+		return addrs
+	}
+	for _, v := range h.Values("X-Forwarded-For") {
+		for _, addr := range strings.Split(v, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+	return addrs
+}
+
+// parseForwardedIP 解析可能带有端口或方括号的地址
+func parseForwardedIP(addr string) net.IP {
+	if ip := net.ParseIP(addr); ip != nil {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	return net.ParseIP(strings.Trim(addr, "[]"))
+}
+
+// ClientIP 返回客户端地址，在路由器信任代理时使用代理请求头中记录的地址
+// 参考 Router.TrustedProxies()
+func ClientIP(r *http.Request) net.IP {
+	if f := forwardedFrom(r); f != nil && f.clientIP != nil {
+		return f.clientIP
+	}
+	return remoteIP(r)
+}
+
+// forwardedFrom 返回请求上下文中转发的主机和方案(如果有)
+func forwardedFrom(r *http.Request) *forwarded {
+	if rv := r.Context().Value(forwardedKey); rv != nil {
+		return rv.(*forwarded)
+	}
+	return nil
+}
+
+// parseForwarded 解析代理请求头，优先使用 Forwarded
+// 多个代理时使用最后一个值，即离路由器最近的代理添加的值
+func parseForwarded(h http.Header) *forwarded {
+	f := &forwarded{}
+	if v := lastHeaderValue(h, "Forwarded"); v != "" {
+		for _, pair := range strings.Split(v, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok {
+				continue
+			}
+			value = strings.Trim(value, `"`)
+			switch strings.ToLower(key) {
+			case "host":
+				f.host = value
+			case "proto":
+				f.scheme = strings.ToLower(value)
+			}
+		}
+	}
+	if f.host == "" {
+		f.host = lastHeaderValue(h, "X-Forwarded-Host")
+	}
+	if f.scheme == "" {
+		f.scheme = strings.ToLower(lastHeaderValue(h, "X-Forwarded-Proto"))
+	}
+	return f
+}
+
+// lastHeaderValue 返回逗号分隔的请求头中的最后一个值
+func lastHeaderValue(h http.Header, key string) string {
+	values := h.Values(key)
+	if len(values) == 0 {
+		return ""
+	}
+	v := values[len(values)-1]
+	if i := strings.LastIndexByte(v, ','); i >= 0 {
+		v = v[i+1:]
+	}
+	return strings.TrimSpace(v)
+}
+
+// requestScheme 返回请求的方案，信任代理时返回转发的方案
+func requestScheme(r *http.Request) string {
+	if f := forwardedFrom(r); f != nil && f.scheme != "" {
+		return f.scheme
+	}
+	scheme := r.URL.Scheme
+	if scheme == "" {
+		if r.TLS == nil {
+			scheme = "http"
+		} else {
+			scheme = "https"
+		}
+	}
+	return scheme
+}
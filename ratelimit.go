@@ -0,0 +1,236 @@
+package mux
+
+import (
+	"context"
+	"hash/maphash"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MetadataRateLimit 路由元数据中限流策略的键，值为 RateLimit
+//
+//	r.HandleFunc("/search", SearchHandler).
+//	  Metadata(mux.MetadataRateLimit, mux.RateLimit{Requests: 10, Per: time.Minute})
+const MetadataRateLimit = "mux.ratelimit"
+
+// rateLimitShards 令牌桶分片的数量
+const rateLimitShards = 64
+
+// RateLimit 令牌桶限流策略，每个键每 Per 时间补充 Requests 个令牌
+type RateLimit struct {
+	// Name 策略名称，名称相同的路由共享令牌桶，为空时每个路由使用自己的令牌桶
+	Name string
+	// Requests 每个周期允许的请求数，不大于0时不限流
+	Requests int
+	// Per 周期
+	Per time.Duration
+	// Burst 令牌桶容量，默认等于 Requests
+	Burst int
+	// Key 从请求中计算限流的键，为空时使用 RateLimiterOptions.Key
+	Key RateLimitKeyFunc
+}
+
+func (p *RateLimit) burst() int {
+	if p.Burst > 0 {
+		return p.Burst
+	}
+	return p.Requests
+}
+
+// rate 返回每秒补充的令牌数
+func (p *RateLimit) rate() float64 {
+	return float64(p.Requests) / p.Per.Seconds()
+}
+
+// RateLimitKeyFunc 从请求中计算限流的键，返回空字符串的请求共享同一个令牌桶
+type RateLimitKeyFunc func(r *http.Request) string
+
+// KeyByClientIP 以客户端地址作为键，信任代理时使用转发的地址，参考 ClientIP
+func KeyByClientIP(r *http.Request) string {
+	if ip := ClientIP(r); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+// KeyByHeader 以请求头的值作为键，如 API 密钥，请求头为空时使用客户端地址
+func KeyByHeader(name string) RateLimitKeyFunc {
+	return func(r *http.Request) string {
+		if v := r.Header.Get(name); v != "" {
+			return "header:" + v
+		}
+		return KeyByClientIP(r)
+	}
+}
+
+// KeyBySubject 以认证主体的标识作为键，参考 PrincipalFromContext，没有主体时使用客户端地址
+func KeyBySubject(r *http.Request) string {
+	if p := PrincipalFromContext(r.Context()); p != nil {
+		return "subject:" + p.Subject()
+	}
+	return KeyByClientIP(r)
+}
+
+// KeyByVar 以路由变量作为键，如租户ID
+func KeyByVar(name string) RateLimitKeyFunc {
+	return func(r *http.Request) string {
+		return Vars(r)[name]
+	}
+}
+
+// RateLimiterOptions 配置 RateLimiter
+type RateLimiterOptions struct {
+	// Default 路由没有在元数据中设置策略时使用的策略，零值表示不限流
+	Default RateLimit
+	// Key 策略没有设置 Key 时使用的函数，默认为 KeyByClientIP
+	Key RateLimitKeyFunc
+	// LimitHandler 超出限制时使用的处理器，默认返回429
+	// 调用时已经设置了 Retry-After 和 RateLimit-* 响应头
+	LimitHandler http.Handler
+}
+
+// RateLimiter 基于内存的令牌桶限流器，令牌桶按键分片以减少锁竞争
+type RateLimiter struct {
+	opts   RateLimiterOptions
+	seed   maphash.Seed
+	shards [rateLimitShards]rateLimitShard
+	now    func() time.Time
+}
+
+type rateLimitShard struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	// 上次清理后的令牌桶数量
+	swept int
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	// 令牌桶装满的时间，之后可以被清理
+	full time.Time
+}
+
+// NewRateLimiter 创建限流器
+func NewRateLimiter(opts RateLimiterOptions) *RateLimiter {
+	if opts.Key == nil {
+		opts.Key = KeyByClientIP
+	}
+	l := &RateLimiter{opts: opts, seed: maphash.MakeSeed(), now: time.Now}
+	for i := range l.shards {
+		l.shards[i].buckets = make(map[string]*tokenBucket)
+	}
+	return l
+}
+
+// Middleware 限流中间件，策略从 CurrentRoute 的元数据中读取，
+// 应该通过 Router.Use 注册在需要限流的路由器或子路由器上，同时注册在两者上时只计数一次
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Context().Value(l) != nil {
+			next.ServeHTTP(w, req)
+			return
+		}
+		req = req.WithContext(context.WithValue(req.Context(), l, true))
+		policy, scope := l.policy(req)
+		if policy.Requests <= 0 || policy.Per <= 0 {
+			next.ServeHTTP(w, req)
+			return
+		}
+		key := policy.Key
+		if key == nil {
+			key = l.opts.Key
+		}
+		allowed, remaining, retry, reset := l.take(scope+"\x00"+key(req), &policy)
+
+		h := w.Header()
+		h.Set("RateLimit-Limit", strconv.Itoa(policy.burst()))
+		h.Set("RateLimit-Remaining", strconv.Itoa(remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(reset)))
+		h.Set("RateLimit-Policy", strconv.Itoa(policy.burst())+";w="+strconv.Itoa(ceilSeconds(policy.Per)))
+		if allowed {
+			next.ServeHTTP(w, req)
+			return
+		}
+		h.Set("Retry-After", strconv.Itoa(ceilSeconds(retry)))
+		if l.opts.LimitHandler != nil {
+			l.opts.LimitHandler.ServeHTTP(w, req)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+	})
+}
+
+// policy 返回请求适用的策略和令牌桶的作用域
+func (l *RateLimiter) policy(req *http.Request) (RateLimit, string) {
+	policy := l.opts.Default
+	route := CurrentRoute(req)
+	if route != nil {
+		switch v := route.GetMetadataValueOr(MetadataRateLimit, nil).(type) {
+		case RateLimit:
+			policy = v
+		case *RateLimit:
+			policy = *v
+		}
+	}
+	if policy.Name != "" {
+		return policy, policy.Name
+	}
+	return policy, routeLabel(route)
+}
+
+// take 从键对应的令牌桶中取出一个令牌
+// 返回是否允许、剩余令牌数、下一个令牌可用的时间和令牌桶装满的时间
+func (l *RateLimiter) take(key string, p *RateLimit) (bool, int, time.Duration, time.Duration) {
+	now := l.now()
+	burst, rate := float64(p.burst()), p.rate()
+	shard := &l.shards[maphash.String(l.seed, key)%rateLimitShards]
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	b := shard.buckets[key]
+	if b == nil {
+		shard.sweep(now)
+		b = &tokenBucket{tokens: burst, last: now}
+		shard.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	var retry time.Duration
+	if !allowed {
+		retry = secondsToDuration((1 - b.tokens) / rate)
+	}
+	reset := secondsToDuration((burst - b.tokens) / rate)
+	b.full = now.Add(reset)
+	return allowed, int(b.tokens), retry, reset
+}
+
+// sweep 在令牌桶数量翻倍时清理已经装满的令牌桶，装满的令牌桶和新建的令牌桶没有区别
+func (s *rateLimitShard) sweep(now time.Time) {
+	if len(s.buckets) < 2*s.swept || len(s.buckets) < 128 {
+		return
+	}
+	for k, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, k)
+		}
+	}
+	s.swept = len(s.buckets)
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// ceilSeconds 返回向上取整的秒数
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,139 @@
+package mux
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := NewRateLimiter(RateLimiterOptions{Default: RateLimit{Requests: 2, Per: time.Second}})
+	limiter.now = func() time.Time { return now }
+
+	router := NewRouter()
+	router.HandleFunc("/a", stringHandler("a"))
+	router.HandleFunc("/b", stringHandler("b"))
+	router.HandleFunc("/pdf", stringHandler("pdf")).
+		Metadata(MetadataRateLimit, RateLimit{Requests: 1, Per: time.Minute})
+	router.Use(limiter.Middleware)
+
+	serve := func(path, remoteAddr string) *ResponseRecorder {
+		req := newRequest("GET", path)
+		req.RemoteAddr = remoteAddr
+		rw := NewRecorder()
+		router.ServeHTTP(rw, req)
+		return rw
+	}
+
+	for i := 0; i < 2; i++ {
+		if rw := serve("/a", "1.1.1.1:1"); rw.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected 200, got %d", i, rw.Code)
+		}
+	}
+	rw := serve("/a", "1.1.1.1:1")
+	if rw.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", rw.Code)
+	}
+	for k, v := range map[string]string{
+		"Retry-After":         "1",
+		"RateLimit-Limit":     "2",
+		"RateLimit-Remaining": "0",
+		"RateLimit-Reset":     "1",
+		"RateLimit-Policy":    "2;w=1",
+	} {
+		if got := rw.HeaderMap.Get(k); got != v {
+			t.Errorf("%s = %q, want %q", k, got, v)
+		}
+	}
+
+	if rw := serve("/b", "1.1.1.1:1"); rw.Code != http.StatusOK {
+		t.Errorf("Expected separate bucket per route, got %d", rw.Code)
+	}
+	if rw := serve("/a", "2.2.2.2:1"); rw.Code != http.StatusOK {
+		t.Errorf("Expected separate bucket per client, got %d", rw.Code)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if rw := serve("/a", "1.1.1.1:1"); rw.Code != http.StatusOK {
+		t.Errorf("Expected token to be refilled, got %d", rw.Code)
+	}
+
+	serve("/pdf", "1.1.1.1:1")
+	rw = serve("/pdf", "1.1.1.1:1")
+	if rw.Code != http.StatusTooManyRequests || rw.HeaderMap.Get("Retry-After") != "60" {
+		t.Errorf("Expected route policy, got %d %v", rw.Code, rw.HeaderMap)
+	}
+}
+
+func TestRateLimiterKeys(t *testing.T) {
+	limiter := NewRateLimiter(RateLimiterOptions{
+		LimitHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}),
+	})
+
+	router := NewRouter()
+	if err := router.TrustedProxies("10.0.0.0/8"); err != nil {
+		t.Fatal(err)
+	}
+	tenants := router.PathPrefix("/tenants").Subrouter()
+	tenants.HandleFunc("/{tenant}/x", stringHandler("x")).
+		Metadata(MetadataRateLimit, RateLimit{Name: "tenant", Requests: 1, Per: time.Hour, Key: KeyByVar("tenant")})
+	tenants.HandleFunc("/{tenant}/y", stringHandler("y")).
+		Metadata(MetadataRateLimit, &RateLimit{Name: "tenant", Requests: 1, Per: time.Hour, Key: KeyByVar("tenant")})
+	tenants.Use(limiter.Middleware)
+	router.HandleFunc("/ip", stringHandler("ip")).
+		Metadata(MetadataRateLimit, RateLimit{Requests: 1, Per: time.Hour})
+	router.HandleFunc("/key", stringHandler("key")).
+		Metadata(MetadataRateLimit, RateLimit{Requests: 1, Per: time.Hour, Key: KeyByHeader("X-API-Key")})
+	router.HandleFunc("/free", stringHandler("free"))
+	router.Use(limiter.Middleware)
+
+	tests := []struct {
+		path    string
+		headers []string
+		expCode int
+	}{
+		{"/tenants/acme/x", nil, http.StatusOK},
+		{"/tenants/acme/y", nil, http.StatusServiceUnavailable},
+		{"/tenants/other/y", nil, http.StatusOK},
+		{"/ip", []string{"X-Forwarded-For", "203.0.113.1"}, http.StatusOK},
+		{"/ip", []string{"X-Forwarded-For", "203.0.113.2"}, http.StatusOK},
+		{"/ip", []string{"X-Forwarded-For", "203.0.113.1"}, http.StatusServiceUnavailable},
+		{"/key", []string{"X-API-Key", "k1"}, http.StatusOK},
+		{"/key", []string{"X-API-Key", "k2"}, http.StatusOK},
+		{"/key", []string{"X-API-Key", "k1"}, http.StatusServiceUnavailable},
+		{"/free", nil, http.StatusOK},
+		{"/free", nil, http.StatusOK},
+	}
+	for _, test := range tests {
+		req := newRequestWithHeaders("GET", test.path, test.headers...)
+		req.RemoteAddr = "10.0.0.1:1234"
+		rw := NewRecorder()
+		router.ServeHTTP(rw, req)
+		if rw.Code != test.expCode {
+			t.Errorf("%s %v: expected %d, got %d", test.path, test.headers, test.expCode, rw.Code)
+		}
+	}
+}
+
+type testPrincipal struct {
+	id     string
+	scopes []string
+	roles  []string
+}
+
+func (p *testPrincipal) Subject() string { return p.id }
+
+func TestKeyBySubject(t *testing.T) {
+	req := newRequest("GET", "/")
+	req.RemoteAddr = "1.2.3.4:5"
+	if k := KeyBySubject(req); k != "1.2.3.4" {
+		t.Errorf("Expected client IP without principal, got %q", k)
+	}
+	req = req.WithContext(WithPrincipal(req.Context(), &testPrincipal{id: "alice"}))
+	if k := KeyBySubject(req); k != "subject:alice" {
+		t.Errorf("Expected subject key, got %q", k)
+	}
+}
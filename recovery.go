@@ -0,0 +1,78 @@
+package mux
+
+import (
+	"net/http"
+	"runtime/debug"
+)
+
+// PanicReport 描述处理请求时发生的 panic
+type PanicReport struct {
+	// Request 发生 panic 的请求
+	Request *http.Request
+	// Value recover() 返回的值
+	Value interface{}
+	// Stack 发生 panic 的 goroutine 的调用栈
+	Stack []byte
+	// RouteName 匹配的路由名称，没有名称时为空
+	RouteName string
+	// PathTemplate 匹配的路由路径模板，用于按路由而不是原始URL归类
+	PathTemplate string
+}
+
+// RecoveryOptions 配置 Recovery 中间件
+type RecoveryOptions struct {
+	// Render 写出错误响应，默认返回500
+	// 响应已经开始写出时不会调用它
+	Render func(w http.ResponseWriter, r *http.Request, report *PanicReport)
+	// Report 将报告发送到错误收集系统，为空时不报告
+	Report func(report *PanicReport)
+}
+
+// Recovery 返回将处理器中的 panic 转换为500响应的中间件
+// 通过 Use 注册时只覆盖匹配的处理器，通过 UsePreMatch 注册时也覆盖路由匹配
+// 响应已经开始写出时无法再返回500，会在报告后中断连接
+func Recovery(opts RecoveryOptions) MiddlewareFunc {
+	render := opts.Render
+	if render == nil {
+		render = renderPanic
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			req, rec := withMatchRecord(req)
+			sw := &statusWriter{ResponseWriter: w}
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				// 由 net/http 处理的中断信号
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+				stack := debug.Stack()
+				// 超时处理器在另一个 goroutine 中运行，使用那里的调用栈
+				if p, ok := v.(*handlerPanic); ok {
+					v, stack = p.value, p.stack
+				}
+				report := &PanicReport{Request: req, Value: v, Stack: stack}
+				if route, _ := rec.matched(req); route != nil {
+					report.RouteName = route.GetName()
+					report.PathTemplate, _ = route.GetPathTemplate()
+				}
+				if opts.Report != nil {
+					opts.Report(report)
+				}
+				if sw.wroteHeader() {
+					panic(http.ErrAbortHandler)
+				}
+				render(sw, req, report)
+			}()
+			next.ServeHTTP(sw, req)
+		})
+	}
+}
+
+// renderPanic 使用HTTP状态码500响应请求
+func renderPanic(w http.ResponseWriter, r *http.Request, report *PanicReport) {
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
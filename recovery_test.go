@@ -0,0 +1,77 @@
+package mux
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestRecovery(t *testing.T) {
+	var reports []*PanicReport
+	report := func(r *PanicReport) { reports = append(reports, r) }
+
+	router := NewRouter()
+	router.HandleFunc("/orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}).Name("order")
+	router.Use(Recovery(RecoveryOptions{Report: report}))
+
+	rw := NewRecorder()
+	router.ServeHTTP(rw, newRequest("GET", "/orders/42"))
+
+	if rw.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status code 500, got %d", rw.Code)
+	}
+	if len(reports) != 1 {
+		t.Fatalf("Expected 1 report, got %d", len(reports))
+	}
+	r := reports[0]
+	if r.Value != "boom" || r.RouteName != "order" || r.PathTemplate != "/orders/{id}" {
+		t.Errorf("Unexpected report: %+v", r)
+	}
+	if !bytes.Contains(r.Stack, []byte("recovery_test.go")) {
+		t.Errorf("Expected stack to contain the panicking handler")
+	}
+}
+
+func TestRecoveryPreMatch(t *testing.T) {
+	var report *PanicReport
+	router := NewRouter()
+	router.HandleFunc("/orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+		panic(errors.New("boom"))
+	})
+	router.UsePreMatch(Recovery(RecoveryOptions{
+		Render: func(w http.ResponseWriter, r *http.Request, p *PanicReport) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(p.PathTemplate))
+		},
+		Report: func(p *PanicReport) { report = p },
+	}))
+
+	rw := NewRecorder()
+	router.ServeHTTP(rw, newRequest("GET", "/orders/42"))
+
+	if rw.Code != http.StatusServiceUnavailable || rw.Body.String() != "/orders/{id}" {
+		t.Errorf("Expected custom renderer, got %d %q", rw.Code, rw.Body.String())
+	}
+	if report == nil || report.PathTemplate != "/orders/{id}" {
+		t.Errorf("Expected report with path template, got %+v", report)
+	}
+}
+
+func TestRecoveryAfterWrite(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		panic("boom")
+	})
+	router.Use(Recovery(RecoveryOptions{}))
+
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("Expected http.ErrAbortHandler, got %v", v)
+		}
+	}()
+	router.ServeHTTP(NewRecorder(), newRequest("GET", "/"))
+}
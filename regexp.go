@@ -11,8 +11,10 @@ import (
 )
 
 type routeRegexpOptions struct {
-	strictSlash    bool
-	useEncodedPath bool
+	strictSlash     bool
+	trailingSlash   TrailingSlash
+	useEncodedPath  bool
+	caseInsensitive bool
 }
 
 type regexpType int
@@ -27,22 +29,54 @@ const (
 // newRouteRegexp 解析路由模板并返回routeRegexp,用于匹配主机、路径或查询字符串
 // 名称([a-zA-Z_][a-zA-Z0-9_]*)，但目前唯一的限制名称和模式不能为空，名称不能包含冒号
 func newRouteRegexp(tpl string, typ regexpType, options routeRegexpOptions) (*routeRegexp, error) {
+	// 备份原件
+	template := tpl
+	// 主机开头的 *. 和 **. 是通配变量 "*" 的简写
+	if typ == regexpTypeHost {
+		if strings.HasPrefix(tpl, "**.") {
+			tpl = "{*:**}" + tpl[2:]
+		} else if strings.HasPrefix(tpl, "*.") {
+			tpl = "{*:*}" + tpl[1:]
+		}
+	}
 	// 检查格式是否正确
 	idxs, errBraces := braceIndices(tpl)
 	if errBraces != nil {
 		return nil, errBraces
 	}
-	// 备份原件
-	template := tpl
 	defaultPattern := "[^/]+"
 	if typ == regexpTypeQuery {
 		defaultPattern = ".*"
 	} else if typ == regexpTypeHost {
 		defaultPattern = "[^.]+"
 	}
+	// 主机模板中端口分隔符的位置，-1表示模板没有端口
+	portIdx := -1
+	if typ == regexpTypeHost {
+		portIdx = hostPortIndex(tpl, idxs)
+	}
 	// 如果不匹配，只匹配严格斜杠
 	if typ != regexpTypePath {
 		options.strictSlash = false
+		options.trailingSlash = TrailingSlashExact
+	}
+	if options.trailingSlash == 0 {
+		options.trailingSlash = TrailingSlashExact
+		if options.strictSlash {
+			options.trailingSlash = TrailingSlashRedirect
+		}
+	}
+	options.strictSlash = options.trailingSlash != TrailingSlashExact
+	// 只有路径的字面量部分忽略大小写
+	if typ != regexpTypePath && typ != regexpTypePrefix {
+		options.caseInsensitive = false
+	}
+	quote := func(raw string) string {
+		q := regexp.QuoteMeta(raw)
+		if options.caseInsensitive && q != "" {
+			q = "(?i:" + q + ")"
+		}
+		return q
 	}
 	// 为strictSlash设置一个标志
 	endSlash := false
@@ -52,27 +86,55 @@ func newRouteRegexp(tpl string, typ regexpType, options routeRegexpOptions) (*ro
 	}
 	varsN := make([]string, len(idxs)/2)
 	varsR := make([]*regexp.Regexp, len(idxs)/2)
+	literals := make([]string, 0, len(idxs)/2+1)
 	pattern := bytes.NewBufferString("")
 	pattern.WriteByte('^')
 	reverse := bytes.NewBufferString("")
 	var end int
 	var err error
+	var multi, optional bool
+	var defaultValue string
 	for i := 0; i < len(idxs); i += 2 {
 		raw := tpl[end:idxs[i]]
 		end = idxs[i+1]
 		parts := strings.SplitN(tpl[idxs[i]+1:end-1], ":", 2)
 		name := parts[0]
 		patt := defaultPattern
+		if portIdx >= 0 && idxs[i] > portIdx {
+			patt = "[0-9]+"
+		}
 		if len(parts) == 2 {
 			patt = parts[1]
 		}
+		// 主机中的 * 匹配一级子域名，** 匹配一级或多级子域名
+		if typ == regexpTypeHost {
+			switch patt {
+			case "*":
+				patt = "[^.]+"
+			case "**":
+				patt = `[^.]+(?:\.[^.]+)*`
+			}
+		}
+		// 查询中带有 =default 的变量是可选的
+		if typ == regexpTypeQuery {
+			if j := strings.Index(name, "="); j >= 0 {
+				name, defaultValue = name[:j], name[j+1:]
+				optional = true
+			}
+		}
+		// 查询中以 [] 结尾的变量匹配键的每一次出现
+		if typ == regexpTypeQuery && strings.HasSuffix(name, "[]") {
+			name = name[:len(name)-2]
+			multi = true
+		}
 		//  名称或模式不能为空
 		if name == "" || patt == "" {
 			return nil, fmt.Errorf("mux: missing name or pattern in %q",
 				tpl[idxs[i]:end])
 		}
 		// 构建regexp模式
-		fmt.Fprintf(pattern, "%s(?P<%s>%s)", regexp.QuoteMeta(raw), varGroupName(i/2), patt)
+		fmt.Fprintf(pattern, "%s(?P<%s>%s)", quote(raw), varGroupName(i/2), patt)
+		literals = append(literals, raw)
 
 		// 构建反向模板
 		fmt.Fprintf(reverse, "%s%%s", raw)
@@ -86,29 +148,48 @@ func newRouteRegexp(tpl string, typ regexpType, options routeRegexpOptions) (*ro
 	}
 	// 加入剩下的
 	raw := tpl[end:]
-	pattern.WriteString(regexp.QuoteMeta(raw))
+	pattern.WriteString(quote(raw))
+	literals = append(literals, raw)
 	if options.strictSlash {
 		pattern.WriteString("[/]?")
 	}
+	var queryKey string
 	if typ == regexpTypeQuery {
+		kv := strings.SplitN(template, "=", 2)
+		queryKey = kv[0]
 		// 如果查询值为空，则添加默认模式
-		if queryVal := strings.SplitN(template, "=", 2)[1]; queryVal == "" {
+		if kv[1] == "" {
 			pattern.WriteString(defaultPattern)
 		}
+		// 多值变量和可选变量必须是完整的查询值
+		if (multi || optional) && (len(idxs) != 2 || idxs[0] != len(queryKey)+1 || idxs[1] != len(template)) {
+			return nil, fmt.Errorf("mux: multi-value or optional variable must be the whole query value in %q", template)
+		}
+		if optional && defaultValue != "" && !varsR[0].MatchString(defaultValue) {
+			return nil, fmt.Errorf("mux: default value %q doesn't match, expected %q",
+				defaultValue, varsR[0].String())
+		}
 	}
 	if typ != regexpTypePrefix {
 		pattern.WriteByte('$')
 	}
 
-	var wildcardHostPort bool
-	if typ == regexpTypeHost {
-		if !strings.Contains(pattern.String(), ":") {
-			wildcardHostPort = true
-		}
-	}
+	// 模板中没有端口时不严格匹配端口
+	wildcardHostPort := typ == regexpTypeHost && portIdx < 0
 	reverse.WriteString(raw)
-	if endSlash {
-		reverse.WriteByte('/')
+	switch options.trailingSlash {
+	case TrailingSlashRemove:
+		if reverse.Len() == 0 {
+			reverse.WriteByte('/')
+		}
+	case TrailingSlashAdd:
+		if !strings.HasSuffix(reverse.String(), "/") {
+			reverse.WriteByte('/')
+		}
+	default:
+		if endSlash {
+			reverse.WriteByte('/')
+		}
 	}
 	// 编译完整的正则表达式
 	reg, errCompile := regexp.Compile(pattern.String())
@@ -130,6 +211,11 @@ func newRouteRegexp(tpl string, typ regexpType, options routeRegexpOptions) (*ro
 		reverse:          reverse.String(),
 		varsN:            varsN,
 		varsR:            varsR,
+		literals:         literals,
+		queryKey:         queryKey,
+		multi:            multi,
+		optional:         optional,
+		defaultValue:     defaultValue,
 		wildcardHostPort: wildcardHostPort,
 	}, nil
 }
@@ -150,6 +236,16 @@ type routeRegexp struct {
 	varsN []string
 	// 变量regexp(验证器)
 	varsR []*regexp.Regexp
+	// 变量之间的字面量
+	literals []string
+	// 查询的键
+	queryKey string
+	// 如果为 true, 查询变量匹配键的每一次出现
+	multi bool
+	// 如果为 true, 查询键不存在时使用默认值
+	optional bool
+	// 可选查询变量的默认值
+	defaultValue string
 	// 通配符主机端口(主机名中没有严格的端口匹配)
 	wildcardHostPort bool
 }
@@ -160,9 +256,7 @@ func (r *routeRegexp) Match(req *http.Request, match *RouteMatch) bool {
 		host := getHost(req)
 		if r.wildcardHostPort {
 			// Don't be strict on the port match
-			if i := strings.Index(host, ":"); i != -1 {
-				host = host[:i]
-			}
+			host, _ = splitHostPort(host)
 		}
 		return r.regexp.MatchString(host)
 	}
@@ -177,6 +271,18 @@ func (r *routeRegexp) Match(req *http.Request, match *RouteMatch) bool {
 	return r.regexp.MatchString(path)
 }
 
+// slashMismatch 报告在 TrailingSlashNotFound 策略下，请求路径是否只有尾斜杠与模板不同
+func (r *routeRegexp) slashMismatch(req *http.Request) bool {
+	if r.options.trailingSlash != TrailingSlashNotFound {
+		return false
+	}
+	path := req.URL.Path
+	if r.options.useEncodedPath {
+		path = req.URL.EscapedPath()
+	}
+	return strings.HasSuffix(path, "/") != strings.HasSuffix(r.template, "/")
+}
+
 // url 使用给定的值构建URL部分
 func (r *routeRegexp) url(values map[string]string) (string, error) {
 	urlValues := make([]interface{}, len(r.varsN), len(r.varsN))
@@ -204,21 +310,56 @@ func (r *routeRegexp) url(values map[string]string) (string, error) {
 	return rv, nil
 }
 
+// urlMulti 使用给定的多个值构建重复键的查询
+func (r *routeRegexp) urlMulti(values []string) (string, error) {
+	if len(values) == 0 {
+		return "", fmt.Errorf("mux: missing route variable %q", r.varsN[0])
+	}
+	queries := make([]string, 0, len(values))
+	for _, v := range values {
+		if !r.varsR[0].MatchString(v) {
+			return "", fmt.Errorf(
+				"mux: variable %q doesn't match, expected %q", v,
+				r.varsR[0].String())
+		}
+		queries = append(queries, r.queryKey+"="+url.QueryEscape(v))
+	}
+	return strings.Join(queries, "&"), nil
+}
+
 // getURLQuery 从请求URL返回一个查询参数
 func (r *routeRegexp) getURLQuery(req *http.Request) string {
 	if r.regexpType != regexpTypeQuery {
 		return ""
 	}
-	templateKey := strings.SplitN(r.template, "=", 2)[0]
-	val, ok := findFirstQueryKey(req.URL.RawQuery, templateKey)
+	val, ok := findFirstQueryKey(req.URL.RawQuery, r.queryKey)
 	if ok {
-		return templateKey + "=" + val
+		return r.queryKey + "=" + val
 	}
 	return ""
 }
 
 // findFirstQueryKey 返回与(*url.URL). query ()[key][0]相同的结果,如果没有找到键，则返回空字符串和false
 func findFirstQueryKey(rawQuery, key string) (value string, ok bool) {
+	eachQueryValue(rawQuery, key, func(v string) bool {
+		value, ok = v, true
+		return false
+	})
+	return value, ok
+}
+
+// findAllQueryKey 返回与(*url.URL). query ()[key]相同的结果
+func findAllQueryKey(rawQuery, key string) []string {
+	var values []string
+	eachQueryValue(rawQuery, key, func(v string) bool {
+		values = append(values, v)
+		return true
+	})
+	return values
+}
+
+// eachQueryValue 按顺序对键的每个值调用fn，fn返回false时停止
+func eachQueryValue(rawQuery, key string, fn func(value string) bool) {
 	query := []byte(rawQuery)
 	for len(query) > 0 {
 		foundKey := query
@@ -249,15 +390,76 @@ func findFirstQueryKey(rawQuery, key string) (value string, ok bool) {
 		if err != nil {
 			continue
 		}
-		return valueString, true
+		if !fn(valueString) {
+			return
+		}
 	}
-	return "", false
+}
+
+// queryKeys 按出现顺序返回查询中所有的键，可能重复
+func queryKeys(rawQuery string) []string {
+	var keys []string
+	for _, part := range strings.FieldsFunc(rawQuery, func(c rune) bool { return c == '&' || c == ';' }) {
+		if i := strings.IndexByte(part, '='); i >= 0 {
+			part = part[:i]
+		}
+		if key, err := url.QueryUnescape(part); err == nil && key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// canonicalCase 将路径中匹配模板字面量的部分替换为模板中的大小写，变量部分保持不变
+func (r *routeRegexp) canonicalCase(path string, matches []int) string {
+	var b strings.Builder
+	pos := 0
+	for i, lit := range r.literals {
+		end := len(path)
+		if i < len(r.varsN) {
+			end = matches[2*i+2]
+		}
+		seg := path[pos:end]
+		if len(seg) >= len(lit) && strings.EqualFold(seg[:len(lit)], lit) {
+			b.WriteString(lit)
+			b.WriteString(seg[len(lit):])
+		} else {
+			b.WriteString(seg)
+		}
+		if i < len(r.varsN) {
+			pos = matches[2*i+3]
+			b.WriteString(path[end:pos])
+		}
+	}
+	return b.String()
 }
 
 func (r *routeRegexp) matchQueryString(req *http.Request) bool {
+	if r.multi {
+		values := findAllQueryKey(req.URL.RawQuery, r.queryKey)
+		if len(values) == 0 {
+			return r.optional
+		}
+		for _, v := range values {
+			if !r.regexp.MatchString(r.queryKey + "=" + v) {
+				return false
+			}
+		}
+		return true
+	}
+	if r.optional {
+		if _, ok := findFirstQueryKey(req.URL.RawQuery, r.queryKey); !ok {
+			return true
+		}
+	}
 	return r.regexp.MatchString(r.getURLQuery(req))
 }
 
+// isDefault 如果可选查询变量的值可以在构建URL时省略，则返回true
+func (r *routeRegexp) isDefault(values []string) bool {
+	return len(values) == 0 || len(values) == 1 && values[0] == r.defaultValue
+}
+
 // braceIndices 返回字符串的第一级花括号索引,如果大括号不平衡，返回错误
 func braceIndices(s string) ([]int, error) {
 	var level, idx int
@@ -305,9 +507,7 @@ func (v routeRegexpGroup) setMatch(req *http.Request, m *RouteMatch, r *Route) {
 		host := getHost(req)
 		if v.host.wildcardHostPort {
 			// 不要对端口匹配太严格
-			if i := strings.Index(host, ":"); i != -1 {
-				host = host[:i]
-			}
+			host, _ = splitHostPort(host)
 		}
 		matches := v.host.regexp.FindStringSubmatchIndex(host)
 		if len(matches) > 0 {
@@ -324,23 +524,71 @@ func (v routeRegexpGroup) setMatch(req *http.Request, m *RouteMatch, r *Route) {
 		if len(matches) > 0 {
 			extractVars(path, matches, v.path.varsN, m.Vars)
 			// Check if we should redirect.
+			target := path
+			if r.caseRedirect && v.path.options.caseInsensitive {
+				target = v.path.canonicalCase(path, matches)
+			}
 			if v.path.options.strictSlash {
 				p1 := strings.HasSuffix(path, "/")
 				p2 := strings.HasSuffix(v.path.template, "/")
-				if p1 != p2 {
+				switch v.path.options.trailingSlash {
+				case TrailingSlashRemove:
+					p2 = false
+				case TrailingSlashAdd:
+					p2 = true
+				case TrailingSlashMatchBoth:
+					p2 = p1
+				}
+				if p1 && !p2 && target != "/" {
+					target = target[:len(target)-1]
+				} else if !p1 && p2 {
+					target += "/"
+				}
+			}
+			// 最内层的路由先设置，它的模板包含完整路径，外层的路由不再覆盖
+			if target != path && m.rewrite == "" && !m.redirect {
+				if r.rewritePath {
+					m.rewrite = target
+				} else {
 					u, _ := url.Parse(req.URL.String())
-					if p1 {
-						u.Path = u.Path[:len(u.Path)-1]
+					if r.useEncodedPath {
+						if p, err := url.PathUnescape(target); err == nil {
+							u.Path, u.RawPath = p, target
+						}
 					} else {
-						u.Path += "/"
+						u.Path, u.RawPath = target, ""
 					}
-					m.Handler = http.RedirectHandler(u.String(), http.StatusMovedPermanently)
+					m.Handler = http.RedirectHandler(u.String(), r.redirectStatus(req.Method))
+					m.redirect = true
 				}
 			}
 		}
 	}
 	// 存储查询字符串变量
 	for _, q := range v.queries {
+		if q.multi {
+			values := findAllQueryKey(req.URL.RawQuery, q.queryKey)
+			if len(values) == 0 && q.optional {
+				m.Vars[q.varsN[0]] = q.defaultValue
+				if q.defaultValue != "" {
+					values = []string{q.defaultValue}
+				}
+			}
+			if len(values) > 0 {
+				m.Vars[q.varsN[0]] = values[0]
+				if m.VarsMulti == nil {
+					m.VarsMulti = make(map[string][]string)
+				}
+				m.VarsMulti[q.varsN[0]] = values
+			}
+			continue
+		}
+		if q.optional {
+			if _, ok := findFirstQueryKey(req.URL.RawQuery, q.queryKey); !ok {
+				m.Vars[q.varsN[0]] = q.defaultValue
+				continue
+			}
+		}
 		queryURL := q.getURLQuery(req)
 		matches := q.regexp.FindStringSubmatchIndex(queryURL)
 		if len(matches) > 0 {
@@ -349,14 +597,54 @@ func (v routeRegexpGroup) setMatch(req *http.Request, m *RouteMatch, r *Route) {
 	}
 }
 
-// getHost 尽力返回请求主机
+// getHost 尽力返回请求主机，信任代理时返回转发的主机
 func getHost(r *http.Request) string {
+	if f := forwardedFrom(r); f != nil && f.host != "" {
+		return f.host
+	}
 	if r.URL.IsAbs() {
 		return r.URL.Host
 	}
 	return r.Host
 }
 
+// splitHostPort 将 host:port 拆分为主机和端口，支持 "[::1]:8080" 这样的IPv6字面量
+// IPv6字面量保留方括号，没有端口时 port 为空
+func splitHostPort(hostport string) (host, port string) {
+	i := strings.LastIndexByte(hostport, ':')
+	if i < 0 || strings.IndexByte(hostport[i:], ']') >= 0 {
+		return hostport, ""
+	}
+	// 没有方括号的IPv6地址不包含端口
+	if hostport[0] != '[' && strings.IndexByte(hostport[:i], ':') >= 0 {
+		return hostport, ""
+	}
+	return hostport[:i], hostport[i+1:]
+}
+
+// hostPortIndex 返回主机模板中端口分隔符的位置，忽略变量和IPv6字面量中的冒号
+func hostPortIndex(tpl string, idxs []int) int {
+	var brackets int
+	for i, k := 0, 0; i < len(tpl); i++ {
+		if k < len(idxs) && i == idxs[k] {
+			i = idxs[k+1] - 1
+			k += 2
+			continue
+		}
+		switch tpl[i] {
+		case '[':
+			brackets++
+		case ']':
+			brackets--
+		case ':':
+			if brackets == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
 func extractVars(input string, matches []int, names []string, output map[string]string) {
 	for i, name := range names {
 		output[name] = input[matches[2*i+2]:matches[2*i+3]]
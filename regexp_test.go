@@ -39,6 +39,49 @@ func Test_findFirstQueryKey(t *testing.T) {
 	}
 }
 
+func Test_findAllQueryKey(t *testing.T) {
+	tests := []string{
+		"a=1&b=2",
+		"a=1&a=2&a=banana",
+		"a=%2&a=3",
+		"tag=x%20y&b=2&tag=z",
+	}
+	for _, query := range tests {
+		t.Run(query, func(t *testing.T) {
+			all, _ := url.ParseQuery(query)
+			for key, want := range all {
+				got := findAllQueryKey(query, key)
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("findAllQueryKey(%s,%s) = %v, want %v", query, key, got, want)
+				}
+			}
+			if got := findAllQueryKey(query, "missing"); got != nil {
+				t.Errorf("findAllQueryKey(%s,missing) = %v, want nil", query, got)
+			}
+		})
+	}
+}
+
+func Test_splitHostPort(t *testing.T) {
+	tests := []struct {
+		hostport, host, port string
+	}{
+		{"example.com", "example.com", ""},
+		{"example.com:8080", "example.com", "8080"},
+		{"[::1]", "[::1]", ""},
+		{"[::1]:8080", "[::1]", "8080"},
+		{"[fe80::1%25en0]:443", "[fe80::1%25en0]", "443"},
+		{"::1", "::1", ""},
+		{"127.0.0.1:80", "127.0.0.1", "80"},
+	}
+	for _, test := range tests {
+		host, port := splitHostPort(test.hostport)
+		if host != test.host || port != test.port {
+			t.Errorf("splitHostPort(%q) = %q, %q, want %q, %q", test.hostport, host, port, test.host, test.port)
+		}
+	}
+}
+
 func Benchmark_findQueryKey(b *testing.B) {
 	tests := []string{
 		"a=1&b=2",
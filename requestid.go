@@ -0,0 +1,78 @@
+package mux
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// RequestIDHeader 默认携带请求 ID 的请求头和响应头
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen 请求中携带的 ID 的最大长度
+const maxRequestIDLen = 128
+
+// RequestIDOptions 配置 RequestID 中间件
+type RequestIDOptions struct {
+	// Header 读取和写回 ID 的头部，默认为 RequestIDHeader
+	Header string
+	// Generate 生成新的 ID，默认为 32 位十六进制随机数
+	Generate func() string
+	// Validate 校验请求中携带的 ID，不通过时生成新的 ID
+	// 默认只接受不超过 128 个字符的字母、数字和 "-_.:"
+	Validate func(id string) bool
+}
+
+// RequestID 返回设置请求 ID 的中间件，合法的传入 ID 会被沿用，否则生成新的 ID
+// ID 保存在请求上下文中，并写入响应头。通过 UsePreMatch 注册时 404 和 405 也会带有 ID
+func RequestID(opts RequestIDOptions) MiddlewareFunc {
+	header := opts.Header
+	if header == "" {
+		header = RequestIDHeader
+	}
+	generate := opts.Generate
+	if generate == nil {
+		generate = newRequestID
+	}
+	validate := opts.Validate
+	if validate == nil {
+		validate = validRequestID
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			id := req.Header.Get(header)
+			if id == "" || !validate(id) {
+				id = generate()
+			}
+			w.Header().Set(header, id)
+			next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), requestIDKey, id)))
+		})
+	}
+}
+
+// RequestIDFromContext 返回 RequestID 中间件设置的请求 ID，没有时返回空字符串
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+func validRequestID(id string) bool {
+	if len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == ':') {
+			return false
+		}
+	}
+	return true
+}
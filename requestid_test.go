@@ -0,0 +1,55 @@
+package mux
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	var got string
+	router := NewRouter()
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		got = RequestIDFromContext(r.Context())
+	})
+	router.UsePreMatch(RequestID(RequestIDOptions{}))
+
+	rw := NewRecorder()
+	router.ServeHTTP(rw, newRequestWithHeaders("GET", "/", "X-Request-ID", "abc-123"))
+	if got != "abc-123" || rw.HeaderMap.Get("X-Request-ID") != "abc-123" {
+		t.Errorf("Expected incoming ID to be reused, got %q and header %q", got, rw.HeaderMap.Get("X-Request-ID"))
+	}
+
+	for _, id := range []string{"", "bad id", "<script>", strings.Repeat("a", 129)} {
+		rw = NewRecorder()
+		router.ServeHTTP(rw, newRequestWithHeaders("GET", "/", "X-Request-ID", id))
+		if got == id || len(got) != 32 || rw.HeaderMap.Get("X-Request-ID") != got {
+			t.Errorf("Expected generated ID for %q, got %q", id, got)
+		}
+	}
+
+	rw = NewRecorder()
+	router.ServeHTTP(rw, newRequest("GET", "/missing"))
+	if rw.Code != http.StatusNotFound || rw.HeaderMap.Get("X-Request-ID") == "" {
+		t.Errorf("Expected ID on 404, got %d %q", rw.Code, rw.HeaderMap.Get("X-Request-ID"))
+	}
+}
+
+func TestRequestIDAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	router := NewRouter()
+	router.UsePreMatch(
+		RequestID(RequestIDOptions{Header: "X-Trace", Generate: func() string { return "generated" }}),
+		AccessLog(AccessLogOptions{Format: LogJSON, Output: &buf}),
+	)
+
+	rw := NewRecorder()
+	router.ServeHTTP(rw, newRequest("GET", "/missing"))
+	if rw.HeaderMap.Get("X-Trace") != "generated" {
+		t.Errorf("Expected custom header, got %v", rw.HeaderMap)
+	}
+	if !strings.Contains(buf.String(), `"request_id":"generated"`) {
+		t.Errorf("Expected request ID in access log, got %q", buf.String())
+	}
+}
@@ -23,6 +23,12 @@ type Route struct {
 	// 对所有命名路由的全局引用
 	namedRoutes map[string]*Route
 
+	// 路由的元数据，供中间件读取
+	metadata map[any]any
+
+	// 如果为 true, 路由不需要认证，不会被子路由器中的路由继承
+	public bool
+
 	// 从`Router`传入的配置
 	routeConf
 }
@@ -40,6 +46,11 @@ func (r *Route) Match(req *http.Request, match *RouteMatch) bool {
 
 	var matchErr error
 
+	// 前面的路由因尾斜杠不匹配留下的 ErrNotFound 不影响当前路由
+	if match.MatchErr == ErrNotFound {
+		match.MatchErr = nil
+	}
+
 	// 匹配所有
 	for _, m := range r.matchers {
 		if matched := m.Match(req, match); !matched {
@@ -59,6 +70,14 @@ func (r *Route) Match(req *http.Request, match *RouteMatch) bool {
 		}
 	}
 
+	// 只有尾斜杠与模板不同时不匹配，后面的路由仍会尝试
+	if r.regexp.path != nil && r.regexp.path.slashMismatch(req) {
+		if match.MatchErr == nil {
+			match.MatchErr = ErrNotFound
+		}
+		return false
+	}
+
 	if matchErr != nil {
 		match.MatchErr = matchErr
 		return false
@@ -69,6 +88,19 @@ func (r *Route) Match(req *http.Request, match *RouteMatch) bool {
 		match.Handler = r.handler
 	}
 
+	// 严格查询模式只在最终匹配的路由上检查
+	if r.strictQueries && match.Route == nil {
+		if unknown := r.unknownQueries(req); len(unknown) > 0 {
+			f := r.unknownQueryFunc
+			if f == nil {
+				f = unknownQuery
+			}
+			match.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				f(w, req, unknown)
+			})
+		}
+	}
+
 	if match.Route == nil {
 		match.Route = r
 	}
@@ -139,6 +171,45 @@ func (r *Route) GetName() string {
 	return r.name
 }
 
+// Metadata -------------------------------------------------------------------
+
+// Metadata 为路由设置元数据，中间件可以通过 CurrentRoute 读取，如限流策略
+func (r *Route) Metadata(key any, value any) *Route {
+	if r.metadata == nil {
+		r.metadata = make(map[any]any)
+	}
+	r.metadata[key] = value
+	return r
+}
+
+// GetMetadata 返回路由的元数据
+func (r *Route) GetMetadata() map[any]any {
+	return r.metadata
+}
+
+// MetadataContains 如果路由设置了给定键的元数据，则返回true
+func (r *Route) MetadataContains(key any) bool {
+	_, ok := r.metadata[key]
+	return ok
+}
+
+// GetMetadataValue 返回给定键的元数据，没有时返回 ErrMetadataKeyNotFound
+func (r *Route) GetMetadataValue(key any) (any, error) {
+	value, ok := r.metadata[key]
+	if !ok {
+		return nil, ErrMetadataKeyNotFound
+	}
+	return value, nil
+}
+
+// GetMetadataValueOr 返回给定键的元数据，没有时返回 fallbackValue
+func (r *Route) GetMetadataValueOr(key any, fallbackValue any) any {
+	if value, ok := r.metadata[key]; ok {
+		return value
+	}
+	return fallbackValue
+}
+
 // ----------------------------------------------------------------------------
 // 匹配器
 // ----------------------------------------------------------------------------
@@ -151,6 +222,16 @@ func (r *Route) addMatcher(m matcher) *Route {
 	return r
 }
 
+// regexpOptions 返回编译主机、路径和查询模板时使用的选项
+func (r *Route) regexpOptions() routeRegexpOptions {
+	return routeRegexpOptions{
+		strictSlash:     r.strictSlash,
+		trailingSlash:   r.slashPolicy(),
+		useEncodedPath:  r.useEncodedPath,
+		caseInsensitive: r.caseInsensitive,
+	}
+}
+
 // addRegexpMatcher 将主机或路径匹配器和生成器添加到路由
 func (r *Route) addRegexpMatcher(tpl string, typ regexpType) error {
 	if r.err != nil {
@@ -164,10 +245,7 @@ func (r *Route) addRegexpMatcher(tpl string, typ regexpType) error {
 			tpl = strings.TrimRight(r.regexp.path.template, "/") + tpl
 		}
 	}
-	rr, err := newRouteRegexp(tpl, typ, routeRegexpOptions{
-		strictSlash:    r.strictSlash,
-		useEncodedPath: r.useEncodedPath,
-	})
+	rr, err := newRouteRegexp(tpl, typ, r.regexpOptions())
 	if err != nil {
 		return err
 	}
@@ -252,6 +330,15 @@ func (r *Route) HeadersRegexp(pairs ...string) *Route {
 //	r.Host("www.example.com")
 //	r.Host("{subdomain}.domain.com")
 //	r.Host("{subdomain:[a-z]+}.domain.com")
+//	r.Host("domain.com:{port}")
+//	r.Host("[::1]:8080")
+//	r.Host("*.domain.com")
+//	r.Host("**.domain.com")
+//	r.Host("{tenant:**}.domain.com")
+//
+// 模板中没有端口时匹配任意端口，端口中的变量默认匹配 [0-9]+
+// 变量模式 * 匹配一级子域名，** 匹配一级或多级子域名，如 "a.b.domain.com" 中的 "a.b"
+// 开头的 *. 和 **. 会保存在名为 "*" 的变量中
 //
 // 在给定路由中，变量名必须是唯一的。它们可以被检索到
 // 调用 mux.Vars(request).
@@ -310,6 +397,23 @@ func (r *Route) Path(tpl string) *Route {
 	return r
 }
 
+// TrailingSlash 设置路由的尾斜杠策略，参考 Router.TrailingSlash()
+func (r *Route) TrailingSlash(policy TrailingSlash) *Route {
+	if r.err != nil {
+		return r
+	}
+	r.trailingSlash = policy
+	if r.regexp.path != nil && r.regexp.path.regexpType == regexpTypePath {
+		rr, err := newRouteRegexp(r.regexp.path.template, regexpTypePath, r.regexpOptions())
+		if err != nil {
+			r.err = err
+			return r
+		}
+		*r.regexp.path = *rr
+	}
+	return r
+}
+
 // PathPrefix -----------------------------------------------------------------
 
 // PathPrefix 为URL路径前缀添加一个匹配器见Route.Path()
@@ -332,6 +436,17 @@ func (r *Route) PathPrefix(tpl string) *Route {
 // 变量可以定义一个可选的regexp模式来匹配
 // - {name} 匹配下一个斜杠之前的任何内容
 // - {name:pattern} 匹配给定的regexp模式
+// - {name[]} 或 {name[]:pattern} 匹配键的每一次出现，所有值可通过 mux.VarsMulti(request) 获取
+// - {name=default} 或 {name=default:pattern} 是可选的，键不存在时使用默认值，存在时仍然需要匹配
+//
+// 示例:
+//
+//	r.Queries("page", "{page=1:[0-9]+}")
+//
+// 上面的路由会匹配 ?page=2 和没有 page 的请求，后者的 mux.Vars(request)["page"] 为 "1"
+// 构建URL时，等于默认值或缺少的可选变量会被省略
+//
+// 构建URL时，多值变量可以在参数中重复，如 URL("tags", "a", "tags", "b")
 func (r *Route) Queries(pairs ...string) *Route {
 	length := len(pairs)
 	if length%2 != 0 {
@@ -348,6 +463,52 @@ func (r *Route) Queries(pairs ...string) *Route {
 	return r
 }
 
+// StrictQueries 拒绝包含未声明查询参数的请求
+// 路由的 Queries 模板中的键和给定的键是允许的，其余的键会交给 UnknownQueryHandler 处理
+// 默认返回400并列出未知的键，示例:
+//
+//	r := mux.NewRouter()
+//	r.HandleFunc("/items", ItemsHandler).
+//	  Queries("page", "{page=1:[0-9]+}").
+//	  StrictQueries("debug")
+//
+// 上面的路由会拒绝 ?page=2&pgae=3，但允许 ?page=2&debug=1
+func (r *Route) StrictQueries(allowed ...string) *Route {
+	r.strictQueries = true
+	r.allowedQueries = append(r.allowedQueries, allowed...)
+	return r
+}
+
+// UnknownQueryHandler 设置严格查询模式下处理未知查询参数的函数
+func (r *Route) UnknownQueryHandler(f UnknownQueryFunc) *Route {
+	r.unknownQueryFunc = f
+	return r
+}
+
+// UnknownQueryFunc 处理包含未知查询参数的请求，unknown 为按出现顺序排列的未知的键
+type UnknownQueryFunc func(w http.ResponseWriter, r *http.Request, unknown []string)
+
+// unknownQueries 返回请求中既不在查询模板中也不在允许列表中的键
+func (r *Route) unknownQueries(req *http.Request) []string {
+	var unknown []string
+	for _, key := range queryKeys(req.URL.RawQuery) {
+		if matchInArray(r.allowedQueries, key) || matchInArray(unknown, key) {
+			continue
+		}
+		known := false
+		for _, q := range r.regexp.queries {
+			if q.queryKey == key {
+				known = true
+				break
+			}
+		}
+		if !known {
+			unknown = append(unknown, key)
+		}
+	}
+	return unknown
+}
+
 // Schemes 为URL模式添加匹配器
 func (r *Route) Schemes(schemes ...string) *Route {
 	for k, v := range schemes {
@@ -457,9 +618,31 @@ func (r *Route) URL(pairs ...string) (*url.URL, error) {
 			return nil, err
 		}
 	}
+	var multi map[string][]string
 	for _, q := range r.regexp.queries {
 		var query string
-		if query, err = q.url(values); err != nil {
+		if q.multi {
+			if multi == nil {
+				multi = mapFromPairsToMulti(pairs...)
+			}
+			vs := multi[q.varsN[0]]
+			if v, ok := values[q.varsN[0]]; ok && len(vs) == 0 {
+				vs = []string{v}
+			}
+			// 省略可选变量的默认值
+			if q.optional && q.isDefault(vs) {
+				continue
+			}
+			query, err = q.urlMulti(vs)
+		} else {
+			if q.optional {
+				if v, ok := values[q.varsN[0]]; !ok || v == q.defaultValue {
+					continue
+				}
+			}
+			query, err = q.url(values)
+		}
+		if err != nil {
 			return nil, err
 		}
 		queries = append(queries, query)
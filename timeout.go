@@ -0,0 +1,163 @@
+package mux
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Timeout 设置新路由的超时时间，子路由会继承此设置，0表示不限制
+// 参考 Route.Timeout()
+func (r *Router) Timeout(d time.Duration) *Router {
+	r.timeout = d
+	return r
+}
+
+// TimeoutHandler 设置新路由超时后使用的处理器，子路由会继承此设置
+// 默认返回503，可以替换为返回504等响应的处理器
+func (r *Router) TimeoutHandler(h http.Handler) *Router {
+	r.timeoutHandler = h
+	return r
+}
+
+// Timeout 设置路由的超时时间，覆盖路由器的默认值，0表示不限制
+// 处理器通过请求上下文得到截止时间，超时后由 TimeoutHandler 写出响应
+// 处理器的输出会先写入缓冲区，超时之后的写入返回 http.ErrHandlerTimeout，
+// 因此设置了超时的路由不支持 Flush 和 Hijack
+func (r *Route) Timeout(d time.Duration) *Route {
+	r.timeout = d
+	return r
+}
+
+// TimeoutHandler 设置路由超时后使用的处理器
+func (r *Route) TimeoutHandler(h http.Handler) *Route {
+	r.timeoutHandler = h
+	return r
+}
+
+// GetTimeout 返回路由生效的超时时间，0表示不限制，可以在 Walk 中用于列出路由
+func (r *Route) GetTimeout() time.Duration {
+	if r.timeout < 0 {
+		return 0
+	}
+	return r.timeout
+}
+
+// withTimeout 为最终匹配的路由的处理器加上超时
+func (r *Route) withTimeout(h http.Handler) http.Handler {
+	d := r.GetTimeout()
+	if d == 0 || h == nil {
+		return h
+	}
+	onTimeout := r.timeoutHandler
+	if onTimeout == nil {
+		onTimeout = http.HandlerFunc(timeoutResponse)
+	}
+	return &timeoutHandler{handler: h, onTimeout: onTimeout, timeout: d}
+}
+
+func timeoutResponse(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+}
+
+// handlerPanic 携带处理器 goroutine 中 panic 的值和调用栈，在服务请求的 goroutine 中重新 panic
+// Recovery 会取出原始的值和调用栈
+type handlerPanic struct {
+	value any
+	stack []byte
+}
+
+func (p *handlerPanic) String() string {
+	return fmt.Sprintf("%v\n\n%s", p.value, p.stack)
+}
+
+// timeoutHandler 在独立的 goroutine 中运行处理器，超时后写出 onTimeout 的响应
+type timeoutHandler struct {
+	handler   http.Handler
+	onTimeout http.Handler
+	timeout   time.Duration
+}
+
+func (h *timeoutHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(req.Context(), h.timeout)
+	defer cancel()
+	req = req.WithContext(ctx)
+
+	done := make(chan struct{})
+	panicChan := make(chan any, 1)
+	tw := &timeoutWriter{header: make(http.Header)}
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				if p != http.ErrAbortHandler {
+					p = &handlerPanic{value: p, stack: debug.Stack()}
+				}
+				panicChan <- p
+			}
+		}()
+		h.handler.ServeHTTP(tw, req)
+		close(done)
+	}()
+
+	select {
+	case p := <-panicChan:
+		panic(p)
+	case <-done:
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		dst := w.Header()
+		for k, v := range tw.header {
+			dst[k] = v
+		}
+		if tw.code == 0 {
+			tw.code = http.StatusOK
+		}
+		w.WriteHeader(tw.code)
+		w.Write(tw.buf.Bytes())
+	case <-ctx.Done():
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		tw.timedOut = true
+		if ctx.Err() == context.DeadlineExceeded {
+			h.onTimeout.ServeHTTP(w, req)
+		}
+	}
+}
+
+// timeoutWriter 缓冲处理器的输出，超时后拒绝写入
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	code     int
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.code == 0 {
+		tw.code = http.StatusOK
+	}
+	return tw.buf.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.code != 0 {
+		return
+	}
+	tw.code = code
+}
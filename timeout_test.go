@@ -0,0 +1,100 @@
+package mux
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	lateErr := make(chan error, 1)
+	served := make(chan struct{})
+	router := NewRouter().Timeout(10 * time.Millisecond)
+	router.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		<-served
+		_, err := w.Write([]byte("late"))
+		lateErr <- err
+	})
+	router.HandleFunc("/fast", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); !ok {
+			t.Error("Expected a context deadline")
+		}
+		w.Header().Set("X-Fast", "1")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("fast"))
+	})
+	router.HandleFunc("/export", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); ok {
+			t.Error("Expected no context deadline")
+		}
+	}).Timeout(0)
+
+	rw := NewRecorder()
+	router.ServeHTTP(rw, newRequest("GET", "/slow"))
+	close(served)
+	if rw.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503, got %d", rw.Code)
+	}
+	if err := <-lateErr; err != http.ErrHandlerTimeout {
+		t.Errorf("Expected ErrHandlerTimeout for late write, got %v", err)
+	}
+
+	rw = NewRecorder()
+	router.ServeHTTP(rw, newRequest("GET", "/fast"))
+	if rw.Code != http.StatusCreated || rw.Body.String() != "fast" || rw.HeaderMap.Get("X-Fast") != "1" {
+		t.Errorf("Unexpected response %d %q %v", rw.Code, rw.Body.String(), rw.HeaderMap)
+	}
+
+	router.ServeHTTP(NewRecorder(), newRequest("GET", "/export"))
+}
+
+func TestTimeoutHandler(t *testing.T) {
+	router := NewRouter().TimeoutHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGatewayTimeout)
+	}))
+	sub := router.PathPrefix("/reports").Subrouter().Timeout(10 * time.Millisecond)
+	sub.HandleFunc("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+
+	rw := NewRecorder()
+	router.ServeHTTP(rw, newRequest("GET", "/reports/1"))
+	if rw.Code != http.StatusGatewayTimeout {
+		t.Errorf("Expected 504, got %d", rw.Code)
+	}
+
+	var timeouts []time.Duration
+	router.Walk(func(route *Route, router *Router, ancestors []*Route) error {
+		timeouts = append(timeouts, route.GetTimeout())
+		return nil
+	})
+	if len(timeouts) != 2 || timeouts[0] != 0 || timeouts[1] != 10*time.Millisecond {
+		t.Errorf("Unexpected timeouts from Walk: %v", timeouts)
+	}
+}
+
+func TestTimeoutPanic(t *testing.T) {
+	router := NewRouter().Timeout(time.Second)
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	var report *PanicReport
+	router.Use(Recovery(RecoveryOptions{Report: func(r *PanicReport) { report = r }}))
+
+	rw := NewRecorder()
+	router.ServeHTTP(rw, newRequest("GET", "/"))
+	if rw.Code != http.StatusInternalServerError {
+		t.Errorf("Expected panic to reach Recovery, got %d", rw.Code)
+	}
+	if report == nil {
+		t.Fatal("Expected panic to be reported")
+	}
+	if report.Value != "boom" {
+		t.Errorf("Expected value %q, got %v", "boom", report.Value)
+	}
+	// 处理器的闭包只出现在它自己的 goroutine 的调用栈中
+	if !bytes.Contains(report.Stack, []byte("TestTimeoutPanic.func1")) {
+		t.Errorf("Expected stack of the panicking handler, got:\n%s", report.Stack)
+	}
+}
@@ -0,0 +1,271 @@
+package mux
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	traceParentHeader = "traceparent"
+	traceStateHeader  = "tracestate"
+)
+
+// Tracer 创建服务端 span，可以通过适配器接入 OpenTelemetry 等实现
+type Tracer interface {
+	// Start 创建一个服务端 span，parent 为请求头中携带的远端上下文，无效时应创建新的 trace
+	Start(ctx context.Context, name string, parent SpanContext) (context.Context, Span)
+}
+
+// Span 一次请求对应的 span
+type Span interface {
+	// SetName 设置 span 名称，路由匹配后会改为 "METHOD /path/{template}"
+	SetName(name string)
+	// SetAttributes 设置属性
+	SetAttributes(attrs ...Attribute)
+	// AddEvent 添加事件
+	AddEvent(name string, attrs ...Attribute)
+	// End 结束 span
+	End()
+}
+
+// Attribute span 的属性
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// SpanContext W3C Trace Context 中的 traceparent 和 tracestate
+type SpanContext struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	Flags      byte
+	TraceState string
+	// Remote 如果为 true，上下文来自请求头
+	Remote bool
+}
+
+// IsValid TraceID 和 SpanID 都不为零时返回 true
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// TraceParent 返回 traceparent 请求头的值
+func (sc SpanContext) TraceParent() string {
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" +
+		hex.EncodeToString(sc.SpanID[:]) + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+// ParseTraceParent 解析 traceparent 请求头，格式为 "00-{trace-id}-{parent-id}-{flags}"
+func ParseTraceParent(s string) (SpanContext, bool) {
+	var sc SpanContext
+	// 未来的版本可以在末尾追加字段
+	if len(s) < 55 || (len(s) > 55 && (s[:2] == "00" || s[55] != '-')) {
+		return sc, false
+	}
+	if s[2] != '-' || s[35] != '-' || s[52] != '-' || s[:2] == "ff" {
+		return sc, false
+	}
+	var version, flags [1]byte
+	if !decodeLowerHex(version[:], s[:2]) ||
+		!decodeLowerHex(sc.TraceID[:], s[3:35]) ||
+		!decodeLowerHex(sc.SpanID[:], s[36:52]) ||
+		!decodeLowerHex(flags[:], s[53:55]) {
+		return SpanContext{}, false
+	}
+	sc.Flags = flags[0]
+	sc.Remote = true
+	if !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	return sc, true
+}
+
+// SpanContextFromRequest 从 traceparent 和 tracestate 请求头中读取远端上下文
+func SpanContextFromRequest(r *http.Request) (SpanContext, bool) {
+	values := r.Header.Values(traceParentHeader)
+	if len(values) != 1 {
+		return SpanContext{}, false
+	}
+	sc, ok := ParseTraceParent(strings.TrimSpace(values[0]))
+	if !ok {
+		return sc, false
+	}
+	var members []string
+	for _, v := range r.Header.Values(traceStateHeader) {
+		for _, m := range strings.Split(v, ",") {
+			if m = strings.TrimSpace(m); m != "" {
+				members = append(members, m)
+			}
+		}
+	}
+	// 规范限制最多 32 个成员，超出时丢弃整个 tracestate
+	if len(members) <= 32 {
+		sc.TraceState = strings.Join(members, ",")
+	}
+	return sc, true
+}
+
+func decodeLowerHex(dst []byte, s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+// Tracing 为每个请求创建服务端 span，包裹 UsePreMatch 中间件和路由匹配
+// span 以 "METHOD /path/{template}" 命名，并记录路由名称、变量和匹配耗时
+func (r *Router) Tracing(t Tracer) *Router {
+	r.tracer = t
+	return r
+}
+
+// serveTraced 在 span 中处理请求
+func (r *Router) serveTraced(w http.ResponseWriter, req *http.Request) {
+	parent, _ := SpanContextFromRequest(req)
+	ctx, span := r.tracer.Start(req.Context(), req.Method, parent)
+	defer span.End()
+	span.SetAttributes(
+		Attribute{"http.request.method", req.Method},
+		Attribute{"url.path", req.URL.Path},
+	)
+
+	sw := &statusWriter{ResponseWriter: w}
+	req = req.WithContext(context.WithValue(ctx, spanKey, span))
+	r.servePreMatch(sw, req)
+	span.SetAttributes(Attribute{"http.response.status_code", sw.Status()})
+}
+
+// traceMatch 记录匹配耗时，匹配成功时用路由模板重命名 span
+func traceMatch(req *http.Request, match *RouteMatch, start time.Time) {
+	span, ok := req.Context().Value(spanKey).(Span)
+	if !ok {
+		return
+	}
+	span.AddEvent("mux.match", Attribute{"mux.match.duration", time.Since(start)})
+	if match.Route == nil || match.MatchErr != nil {
+		return
+	}
+	if tpl, err := match.Route.GetPathTemplate(); err == nil {
+		span.SetName(req.Method + " " + tpl)
+		span.SetAttributes(Attribute{"http.route", tpl})
+	}
+	if name := match.Route.GetName(); name != "" {
+		span.SetAttributes(Attribute{"mux.route.name", name})
+	}
+	for k, v := range match.Vars {
+		span.SetAttributes(Attribute{"mux.route.var." + k, v})
+	}
+}
+
+// MemoryTracer 将 span 保存在内存中的 Tracer，用于测试
+type MemoryTracer struct {
+	mu    sync.Mutex
+	spans []*MemorySpan
+}
+
+// MemorySpan MemoryTracer 记录的 span
+type MemorySpan struct {
+	tracer *MemoryTracer
+
+	Name        string
+	SpanContext SpanContext
+	Parent      SpanContext
+	Attributes  map[string]any
+	Events      []MemoryEvent
+	StartTime   time.Time
+	EndTime     time.Time
+}
+
+// MemoryEvent MemorySpan 记录的事件
+type MemoryEvent struct {
+	Name       string
+	Time       time.Time
+	Attributes map[string]any
+}
+
+// Start 实现 Tracer
+func (t *MemoryTracer) Start(ctx context.Context, name string, parent SpanContext) (context.Context, Span) {
+	s := &MemorySpan{
+		tracer:     t,
+		Name:       name,
+		Parent:     parent,
+		Attributes: make(map[string]any),
+		StartTime:  time.Now(),
+	}
+	if parent.IsValid() {
+		s.SpanContext.TraceID = parent.TraceID
+		s.SpanContext.Flags = parent.Flags
+		s.SpanContext.TraceState = parent.TraceState
+	} else {
+		rand.Read(s.SpanContext.TraceID[:])
+	}
+	rand.Read(s.SpanContext.SpanID[:])
+	t.mu.Lock()
+	t.spans = append(t.spans, s)
+	t.mu.Unlock()
+	return ctx, s
+}
+
+// Spans 返回已结束的 span
+func (t *MemoryTracer) Spans() []*MemorySpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var spans []*MemorySpan
+	for _, s := range t.spans {
+		if !s.EndTime.IsZero() {
+			spans = append(spans, s)
+		}
+	}
+	return spans
+}
+
+// Reset 清空记录的 span
+func (t *MemoryTracer) Reset() {
+	t.mu.Lock()
+	t.spans = nil
+	t.mu.Unlock()
+}
+
+// SetName 实现 Span
+func (s *MemorySpan) SetName(name string) {
+	s.tracer.mu.Lock()
+	s.Name = name
+	s.tracer.mu.Unlock()
+}
+
+// SetAttributes 实现 Span
+func (s *MemorySpan) SetAttributes(attrs ...Attribute) {
+	s.tracer.mu.Lock()
+	for _, a := range attrs {
+		s.Attributes[a.Key] = a.Value
+	}
+	s.tracer.mu.Unlock()
+}
+
+// AddEvent 实现 Span
+func (s *MemorySpan) AddEvent(name string, attrs ...Attribute) {
+	e := MemoryEvent{Name: name, Time: time.Now(), Attributes: make(map[string]any)}
+	for _, a := range attrs {
+		e.Attributes[a.Key] = a.Value
+	}
+	s.tracer.mu.Lock()
+	s.Events = append(s.Events, e)
+	s.tracer.mu.Unlock()
+}
+
+// End 实现 Span
+func (s *MemorySpan) End() {
+	s.tracer.mu.Lock()
+	if s.EndTime.IsZero() {
+		s.EndTime = time.Now()
+	}
+	s.tracer.mu.Unlock()
+}
@@ -0,0 +1,81 @@
+package mux
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	tests := []struct {
+		in string
+		ok bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", false},
+	}
+	for _, tt := range tests {
+		sc, ok := ParseTraceParent(tt.in)
+		if ok != tt.ok {
+			t.Errorf("ParseTraceParent(%q) ok = %v, want %v", tt.in, ok, tt.ok)
+			continue
+		}
+		if ok && sc.TraceParent()[3:] != tt.in[3:55] {
+			t.Errorf("TraceParent() = %q, want %q", sc.TraceParent(), tt.in[:55])
+		}
+	}
+}
+
+func TestTracing(t *testing.T) {
+	tracer := &MemoryTracer{}
+	router := NewRouter().Tracing(tracer)
+	router.HandleFunc("/orders/{id}", stringHandler("order")).Name("order")
+
+	req := newRequestWithHeaders("GET", "/orders/42",
+		"traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"tracestate", "a=1, b=2")
+	router.ServeHTTP(NewRecorder(), req)
+
+	spans := tracer.Spans()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	s := spans[0]
+	if s.Name != "GET /orders/{id}" {
+		t.Errorf("Unexpected span name %q", s.Name)
+	}
+	if s.Parent.TraceParent() != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" || s.Parent.TraceState != "a=1,b=2" {
+		t.Errorf("Unexpected parent %+v", s.Parent)
+	}
+	if s.SpanContext.TraceID != s.Parent.TraceID {
+		t.Errorf("Expected span to continue the remote trace")
+	}
+	for k, v := range map[string]any{
+		"http.route":                "/orders/{id}",
+		"mux.route.name":            "order",
+		"mux.route.var.id":          "42",
+		"http.response.status_code": http.StatusOK,
+	} {
+		if s.Attributes[k] != v {
+			t.Errorf("Attribute %q = %v, want %v", k, s.Attributes[k], v)
+		}
+	}
+	if len(s.Events) != 1 || s.Events[0].Name != "mux.match" {
+		t.Errorf("Expected match event, got %+v", s.Events)
+	}
+
+	tracer.Reset()
+	router.ServeHTTP(NewRecorder(), newRequest("POST", "/missing"))
+	spans = tracer.Spans()
+	if len(spans) != 1 || spans[0].Name != "POST" || spans[0].Parent.IsValid() {
+		t.Errorf("Unexpected spans for unmatched request: %+v", spans)
+	}
+	if spans[0].Attributes["http.response.status_code"] != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %v", spans[0].Attributes["http.response.status_code"])
+	}
+}
@@ -0,0 +1,65 @@
+package mux
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// statusWriter 记录响应的状态码和写入的字节数
+type statusWriter struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+// Status 返回写出的状态码，没有写出时返回200
+func (w *statusWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// wroteHeader 如果已经写出响应头，则返回true
+func (w *statusWriter) wroteHeader() bool {
+	return w.status != 0
+}
+
+func (w *statusWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("mux: response writer does not support hijacking")
+}
+
+// Unwrap 返回被包裹的 ResponseWriter，供 http.ResponseController 使用
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}